@@ -1,13 +1,19 @@
 package config
 
 import (
+	"authentication/mail"
+	"authentication/scanner"
+	"authentication/storage"
 	"context"
+	"crypto/rand"
 	"database/sql"
 	"log"
+	"os"
+	"strconv"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/go-redis/redis/v8"
 	_ "github.com/lib/pq"
 )
@@ -16,27 +22,173 @@ var (
 	DB          *sql.DB
 	RedisClient *redis.Client
 	S3Session   *session.Session
-	S3Uploader  *s3manager.Uploader
+	Storage     storage.Backend
+	Mailer      mail.Sender
+	Scanner     scanner.Scanner
 	Ctx         = context.Background()
+
+	BaseURL         = "http://localhost:8080"
+	TrashRetention  = 30 * 24 * time.Hour
+	AccessTokenTTL  = 15 * time.Minute
+	RefreshTokenTTL = 7 * 24 * time.Hour
+
+	// PasswordResetURL is the front-end page reset emails link to, with the
+	// token in its query string. The page posts it to /password/reset.
+	PasswordResetURL = "http://localhost:3000/reset-password"
+
+	LoginFailureWindow   = 15 * time.Minute
+	LoginLockoutDuration = 15 * time.Minute
+
+	DefaultQuotaBytes int64 = 10 << 30
+	MaxUploadBytes    int64 = 5 << 30
+
+	ResumableUploadTTL = 24 * time.Hour
+	PresignedURLTTL    = 15 * time.Minute
+	ScrubInterval      = 7 * 24 * time.Hour
+	ScanPollInterval   = 10 * time.Second
+
+	JWTSecret       string
+	JWTKeysDir      string
+	JWTSigningKeyID string
 )
 
+func getEnv(key, fallback string) string {
+	if value, ok := os.LookupEnv(key); ok && value != "" {
+		return value
+	}
+	return fallback
+}
+
+func getDurationEnv(key string, fallback time.Duration) time.Duration {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	duration, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("Invalid duration for %s: %v", key, err)
+	}
+	return duration
+}
+
+func getInt64Env(key string, fallback int64) int64 {
+	value := getEnv(key, "")
+	if value == "" {
+		return fallback
+	}
+	parsed, err := strconv.ParseInt(value, 10, 64)
+	if err != nil {
+		log.Fatalf("Invalid integer for %s: %v", key, err)
+	}
+	return parsed
+}
+
 func InitDB() {
 	var err error
-	connStr := "host=localhost user=authenticator dbname=User sslmode=disable password=databasePassword"
+	BaseURL = getEnv("PUBLIC_BASE_URL", BaseURL)
+	PasswordResetURL = getEnv("PASSWORD_RESET_URL", PasswordResetURL)
+	TrashRetention = getDurationEnv("TRASH_RETENTION", TrashRetention)
+	AccessTokenTTL = getDurationEnv("ACCESS_TOKEN_TTL", AccessTokenTTL)
+	RefreshTokenTTL = getDurationEnv("REFRESH_TOKEN_TTL", RefreshTokenTTL)
+	LoginFailureWindow = getDurationEnv("LOGIN_FAILURE_WINDOW", LoginFailureWindow)
+	LoginLockoutDuration = getDurationEnv("LOGIN_LOCKOUT_DURATION", LoginLockoutDuration)
+	DefaultQuotaBytes = getInt64Env("DEFAULT_QUOTA_BYTES", DefaultQuotaBytes)
+	MaxUploadBytes = getInt64Env("MAX_UPLOAD_BYTES", MaxUploadBytes)
+	ResumableUploadTTL = getDurationEnv("RESUMABLE_UPLOAD_TTL", ResumableUploadTTL)
+	PresignedURLTTL = getDurationEnv("PRESIGNED_URL_TTL", PresignedURLTTL)
+	ScrubInterval = getDurationEnv("SCRUB_INTERVAL", ScrubInterval)
+	ScanPollInterval = getDurationEnv("SCAN_POLL_INTERVAL", ScanPollInterval)
+	JWTSecret = getEnv("JWT_SECRET", "")
+	JWTKeysDir = getEnv("JWT_KEYS_DIR", "")
+	JWTSigningKeyID = getEnv("JWT_SIGNING_KEY_ID", "")
+
+	connStr := getEnv("DATABASE_URL", "host=localhost user=authenticator dbname=User sslmode=disable password=databasePassword")
 	DB, err = sql.Open("postgres", connStr)
 	if err != nil {
 		log.Fatal("Failed to connect to the database:", err)
 	}
+	migrate()
 
 	RedisClient = redis.NewClient(&redis.Options{
-		Addr: "localhost:6379",
+		Addr: getEnv("REDIS_ADDR", "localhost:6379"),
 	})
 
-	S3Session, err = session.NewSession(&aws.Config{
-		Region: aws.String("eu-north-1"),
-	})
-	if err != nil {
-		log.Fatal("Failed to create AWS session:", err)
+	initStorage()
+	initMailer()
+	initScanner()
+}
+
+func initStorage() {
+	switch backend := getEnv("STORAGE_BACKEND", "s3"); backend {
+	case "s3":
+		var err error
+		region := getEnv("AWS_REGION", "eu-north-1")
+		S3Session, err = session.NewSession(&aws.Config{
+			Region: aws.String(region),
+		})
+		if err != nil {
+			log.Fatal("Failed to create AWS session:", err)
+		}
+		Storage = storage.NewS3Backend(S3Session, getEnv("S3_BUCKET", "go-file-management-system-bucket"), region)
+	case "local":
+		local, err := storage.NewLocalBackend(getEnv("STORAGE_LOCAL_ROOT", "./data"))
+		if err != nil {
+			log.Fatal("Failed to initialise local storage:", err)
+		}
+		local.EnableSignedURLs(BaseURL+"/storage/local", storageSigningKey())
+		Storage = local
+	default:
+		log.Fatalf("Unknown storage backend %q", backend)
+	}
+}
+
+// storageSigningKey returns the key for the local backend's signed URLs.
+// Without STORAGE_SIGNING_KEY a random key is used, so outstanding URLs stop
+// working when the server restarts.
+func storageSigningKey() []byte {
+	if key := getEnv("STORAGE_SIGNING_KEY", ""); key != "" {
+		return []byte(key)
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		log.Fatal("Failed to generate storage signing key:", err)
+	}
+	return key
+}
+
+func initMailer() {
+	from := getEnv("MAIL_FROM", "no-reply@localhost")
+	switch backend := getEnv("MAIL_BACKEND", "log"); backend {
+	case "smtp":
+		sender, err := mail.NewSMTPSender(getEnv("SMTP_ADDR", "localhost:25"), getEnv("SMTP_USERNAME", ""), getEnv("SMTP_PASSWORD", ""), from)
+		if err != nil {
+			log.Fatal("Failed to configure SMTP mailer:", err)
+		}
+		Mailer = sender
+	case "log":
+		out := os.Stdout
+		if path := getEnv("MAIL_LOG_FILE", ""); path != "" {
+			var err error
+			out, err = os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o600)
+			if err != nil {
+				log.Fatal("Failed to open mail log file:", err)
+			}
+		}
+		Mailer = mail.NewLogSender(out, from)
+	default:
+		log.Fatalf("Unknown mail backend %q", backend)
+	}
+}
+
+// initScanner defaults to the stub, which only recognises the EICAR test
+// file; deployments that must scan uploads should set SCANNER_BACKEND=clamd.
+func initScanner() {
+	switch backend := getEnv("SCANNER_BACKEND", "stub"); backend {
+	case "clamd":
+		Scanner = scanner.NewClamdScanner(getEnv("CLAMD_ADDR", "localhost:3310"))
+	case "stub":
+		Scanner = scanner.NewStubScanner()
+	default:
+		log.Fatalf("Unknown scanner backend %q", backend)
 	}
-	S3Uploader = s3manager.NewUploader(S3Session)
 }
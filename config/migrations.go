@@ -0,0 +1,196 @@
+package config
+
+import (
+	"log"
+)
+
+var migrations = []string{
+	`CREATE TABLE IF NOT EXISTS users (
+		id SERIAL PRIMARY KEY,
+		email TEXT NOT NULL UNIQUE,
+		password TEXT NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS files (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		file_name TEXT NOT NULL,
+		upload_date TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		file_size INTEGER NOT NULL,
+		s3_url TEXT NOT NULL,
+		file_extension TEXT NOT NULL DEFAULT '',
+		shared_user BOOLEAN NOT NULL DEFAULT FALSE,
+		shared_at TIMESTAMPTZ,
+		expiry_date TIMESTAMPTZ
+	)`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS content_sha256 TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS object_key TEXT`,
+	`UPDATE files SET object_key = regexp_replace(s3_url, '^.*/', '') WHERE object_key IS NULL`,
+	`ALTER TABLE files ALTER COLUMN object_key SET NOT NULL`,
+	`CREATE TABLE IF NOT EXISTS folders (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		parent_id INTEGER REFERENCES folders(id),
+		name TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS folders_user_parent_name_idx ON folders (user_id, COALESCE(parent_id, 0), name)`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS folder_id INTEGER REFERENCES folders(id)`,
+	`CREATE TABLE IF NOT EXISTS file_versions (
+		id SERIAL PRIMARY KEY,
+		file_id INTEGER NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+		version INTEGER NOT NULL,
+		object_key TEXT NOT NULL,
+		file_size INTEGER NOT NULL,
+		content_sha256 TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		UNIQUE (file_id, version)
+	)`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS current_version INTEGER NOT NULL DEFAULT 1`,
+	`INSERT INTO file_versions (file_id, version, object_key, file_size, content_sha256, created_at)
+		SELECT id, 1, object_key, file_size, content_sha256, upload_date
+		FROM files f
+		WHERE NOT EXISTS (SELECT 1 FROM file_versions v WHERE v.file_id = f.id)`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS deleted_at TIMESTAMPTZ`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS default_retention_seconds BIGINT`,
+	`CREATE TABLE IF NOT EXISTS share_links (
+		id SERIAL PRIMARY KEY,
+		token_hash TEXT NOT NULL UNIQUE,
+		file_id INTEGER NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+		created_by INTEGER NOT NULL REFERENCES users(id),
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		expires_at TIMESTAMPTZ,
+		max_downloads INTEGER,
+		download_count INTEGER NOT NULL DEFAULT 0,
+		password_hash TEXT,
+		revoked_at TIMESTAMPTZ
+	)`,
+	`CREATE TABLE IF NOT EXISTS file_permissions (
+		file_id INTEGER NOT NULL REFERENCES files(id) ON DELETE CASCADE,
+		user_id INTEGER NOT NULL REFERENCES users(id),
+		permission TEXT NOT NULL CHECK (permission IN ('read', 'write')),
+		granted_by INTEGER NOT NULL REFERENCES users(id),
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		PRIMARY KEY (file_id, user_id)
+	)`,
+	`CREATE TABLE IF NOT EXISTS api_keys (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		name TEXT NOT NULL,
+		key_prefix TEXT NOT NULL,
+		key_hash TEXT NOT NULL UNIQUE,
+		scopes TEXT[] NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		last_used_at TIMESTAMPTZ,
+		revoked_at TIMESTAMPTZ
+	)`,
+	// Accounts that predate email verification are treated as verified.
+	`DO $$
+	BEGIN
+		IF NOT EXISTS (SELECT 1 FROM information_schema.columns WHERE table_name = 'users' AND column_name = 'email_verified_at') THEN
+			ALTER TABLE users ADD COLUMN email_verified_at TIMESTAMPTZ;
+			UPDATE users SET email_verified_at = NOW();
+		END IF;
+	END $$`,
+	`CREATE TABLE IF NOT EXISTS user_tokens (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		purpose TEXT NOT NULL,
+		token_hash TEXT NOT NULL UNIQUE,
+		expires_at TIMESTAMPTZ NOT NULL,
+		used_at TIMESTAMPTZ,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_secret TEXT`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_enabled_at TIMESTAMPTZ`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS totp_last_step BIGINT`,
+	`CREATE TABLE IF NOT EXISTS recovery_codes (
+		id SERIAL PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		code_hash TEXT NOT NULL,
+		used_at TIMESTAMPTZ,
+		UNIQUE (user_id, code_hash)
+	)`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS is_admin BOOLEAN NOT NULL DEFAULT FALSE`,
+	`ALTER TABLE users ADD COLUMN IF NOT EXISTS quota_bytes BIGINT`,
+	`ALTER TABLE files ALTER COLUMN file_size TYPE BIGINT`,
+	`ALTER TABLE file_versions ALTER COLUMN file_size TYPE BIGINT`,
+	`CREATE TABLE IF NOT EXISTS upload_sessions (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		file_id INTEGER REFERENCES files(id) ON DELETE CASCADE,
+		folder_id INTEGER REFERENCES folders(id) ON DELETE SET NULL,
+		file_name TEXT NOT NULL,
+		content_type TEXT NOT NULL DEFAULT '',
+		expiry_date TIMESTAMPTZ,
+		object_key TEXT NOT NULL,
+		storage_upload_id TEXT NOT NULL,
+		upload_length BIGINT NOT NULL,
+		upload_offset BIGINT NOT NULL DEFAULT 0,
+		parts JSONB NOT NULL DEFAULT '[]',
+		sha256_state BYTEA NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		expires_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS pending_uploads (
+		id TEXT PRIMARY KEY,
+		user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+		file_id INTEGER REFERENCES files(id) ON DELETE CASCADE,
+		folder_id INTEGER REFERENCES folders(id) ON DELETE SET NULL,
+		file_name TEXT NOT NULL,
+		content_type TEXT NOT NULL DEFAULT '',
+		expiry_date TIMESTAMPTZ,
+		object_key TEXT NOT NULL,
+		file_size BIGINT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+		expires_at TIMESTAMPTZ NOT NULL
+	)`,
+	`CREATE TABLE IF NOT EXISTS blobs (
+		object_key TEXT PRIMARY KEY,
+		content_sha256 TEXT NOT NULL UNIQUE,
+		file_size BIGINT NOT NULL,
+		ref_count INTEGER NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	// Existing objects become blobs referenced by their versions. Where
+	// identical content was stored twice only the first copy is tracked; the
+	// rest stay unmanaged and are deleted with their single version.
+	`INSERT INTO blobs (object_key, content_sha256, file_size, ref_count)
+		SELECT object_key, MIN(content_sha256), MAX(file_size), COUNT(*)
+		FROM file_versions
+		WHERE content_sha256 <> ''
+		GROUP BY object_key
+		ON CONFLICT DO NOTHING`,
+	`ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS verified_at TIMESTAMPTZ`,
+	`ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS corrupted_at TIMESTAMPTZ`,
+	`ALTER TABLE blobs ADD COLUMN IF NOT EXISTS corrupted_at TIMESTAMPTZ`,
+	// A corrupted blob must not absorb new uploads of the same content, so
+	// only intact blobs need unique hashes.
+	`ALTER TABLE blobs DROP CONSTRAINT IF EXISTS blobs_content_sha256_key`,
+	`CREATE UNIQUE INDEX IF NOT EXISTS blobs_intact_sha256_idx ON blobs (content_sha256) WHERE corrupted_at IS NULL`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS mime_type TEXT NOT NULL DEFAULT ''`,
+	`ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS mime_type TEXT NOT NULL DEFAULT ''`,
+	`CREATE TABLE IF NOT EXISTS mime_policy_rules (
+		id SERIAL PRIMARY KEY,
+		pattern TEXT NOT NULL UNIQUE,
+		action TEXT NOT NULL CHECK (action IN ('allow', 'deny')),
+		created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+	)`,
+	// Files uploaded before scanning was introduced start out pending and
+	// are picked up by the scan worker.
+	`ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS scan_status TEXT NOT NULL DEFAULT 'pending'
+		CHECK (scan_status IN ('pending', 'clean', 'infected'))`,
+	`ALTER TABLE file_versions ADD COLUMN IF NOT EXISTS scanned_at TIMESTAMPTZ`,
+	`ALTER TABLE files ADD COLUMN IF NOT EXISTS scan_status TEXT NOT NULL DEFAULT 'pending'
+		CHECK (scan_status IN ('pending', 'clean', 'infected'))`,
+	`CREATE INDEX IF NOT EXISTS file_versions_pending_scan_idx ON file_versions (object_key) WHERE scan_status = 'pending'`,
+	`CREATE INDEX IF NOT EXISTS pending_uploads_object_key_idx ON pending_uploads (object_key)`,
+	`ALTER TABLE pending_uploads ADD COLUMN IF NOT EXISTS completed_at TIMESTAMPTZ`,
+}
+
+func migrate() {
+	for _, statement := range migrations {
+		if _, err := DB.Exec(statement); err != nil {
+			log.Fatal("Failed to apply database migration:", err)
+		}
+	}
+}
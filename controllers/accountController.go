@@ -0,0 +1,223 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/mail"
+	"authentication/middleware"
+	"authentication/models"
+	"authentication/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	netmail "net/mail"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	emailVerificationTTL = 24 * time.Hour
+	passwordResetTTL     = time.Hour
+)
+
+func validEmail(email string) bool {
+	address, err := netmail.ParseAddress(email)
+	return err == nil && address.Address == email && len(email) <= 254
+}
+
+func issueUserToken(userID int, purpose models.TokenPurpose, ttl time.Duration) (string, error) {
+	token, err := utils.GenerateSecureToken(32)
+	if err != nil {
+		return "", err
+	}
+	err = models.CreateUserToken(userID, purpose, utils.HashToken(token), time.Now().Add(ttl))
+	return token, err
+}
+
+func sendVerificationEmail(userID int, email string) error {
+	token, err := issueUserToken(userID, models.TokenVerifyEmail, emailVerificationTTL)
+	if err != nil {
+		return err
+	}
+	link := fmt.Sprintf("%s/verify-email?token=%s", config.BaseURL, url.QueryEscape(token))
+	return config.Mailer.Send(mail.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body:    fmt.Sprintf("Confirm your email address by opening this link within 24 hours:\n\n%s\n", link),
+	})
+}
+
+func requireVerifiedEmail(w http.ResponseWriter, userID int) bool {
+	verified, err := models.IsEmailVerified(userID)
+	if err != nil {
+		http.Error(w, "Error checking account status: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !verified {
+		http.Error(w, "Verify your email address before uploading files", http.StatusForbidden)
+		return false
+	}
+	return true
+}
+
+func VerifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	token := r.URL.Query().Get("token")
+	if token == "" {
+		http.Error(w, "Missing token", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := models.ConsumeUserToken(models.TokenVerifyEmail, utils.HashToken(token))
+	if errors.Is(err, models.ErrTokenInvalid) {
+		http.Error(w, "Verification link is invalid or has expired", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Error verifying email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = models.MarkEmailVerified(userID)
+	if err != nil {
+		http.Error(w, "Error verifying email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Email verified successfully")
+}
+
+func ResendVerificationHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	verified, err := models.IsEmailVerified(userID)
+	if err != nil {
+		http.Error(w, "Error checking account status: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if verified {
+		http.Error(w, "Email address is already verified", http.StatusConflict)
+		return
+	}
+
+	principal, _ := middleware.PrincipalFromContext(r.Context())
+	err = sendVerificationEmail(userID, principal.Email)
+	if err != nil {
+		http.Error(w, "Error sending verification email: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintln(w, "Verification email sent")
+}
+
+func ForgotPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	// Respond the same way whether or not the account exists so the endpoint
+	// cannot be used to discover registered addresses.
+	user, err := models.GetUserByEmail(strings.TrimSpace(req.Email))
+	if err == nil {
+		token, err := issueUserToken(user.ID, models.TokenResetPassword, passwordResetTTL)
+		if err == nil {
+			link := fmt.Sprintf("%s?token=%s", config.PasswordResetURL, url.QueryEscape(token))
+			err = config.Mailer.Send(mail.Message{
+				To:      user.Email,
+				Subject: "Reset your password",
+				Body:    fmt.Sprintf("Someone asked to reset the password for this account. If it was you, open this link within an hour:\n\n%s\n\nOtherwise you can ignore this email.\n", link),
+			})
+		}
+		if err != nil {
+			log.Printf("Failed to send password reset email to user %d: %v", user.ID, err)
+		}
+	}
+
+	w.WriteHeader(http.StatusAccepted)
+	fmt.Fprintln(w, "If an account exists for that email, a reset link has been sent")
+}
+
+func ResetPasswordHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Token    string `json:"token"`
+		Password string `json:"password"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.Token == "" || req.Password == "" {
+		http.Error(w, "Token and password are required", http.StatusBadRequest)
+		return
+	}
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+	if err != nil {
+		http.Error(w, "Error hashing password", http.StatusInternalServerError)
+		return
+	}
+
+	userID, err := models.ConsumeUserToken(models.TokenResetPassword, utils.HashToken(req.Token))
+	if errors.Is(err, models.ErrTokenInvalid) {
+		http.Error(w, "Reset link is invalid or has expired", http.StatusBadRequest)
+		return
+	} else if err != nil {
+		http.Error(w, "Error resetting password: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = models.UpdatePassword(userID, string(hashedPassword))
+	if err != nil {
+		http.Error(w, "Error resetting password: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// Whoever knew the old password must not stay signed in, while the
+	// owner should not stay locked out by failed attempts.
+	if err := utils.RevokeUserSessions(userID); err != nil {
+		http.Error(w, "Error signing out existing sessions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if email, err := models.GetUserEmailByID(userID); err != nil {
+		log.Printf("Failed to look up user %d to clear login failures: %v", userID, err)
+	} else if err := utils.ClearLoginFailures(email); err != nil {
+		log.Printf("Failed to clear login failures for user %d: %v", userID, err)
+	}
+	// Receiving the reset email proves ownership of the address.
+	if err := models.MarkEmailVerified(userID); err != nil {
+		log.Printf("Failed to mark email verified for user %d: %v", userID, err)
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Password reset successfully")
+}
@@ -0,0 +1,135 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/mail"
+	"authentication/models"
+	"authentication/utils"
+	"bytes"
+	"database/sql"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestForgotPasswordHandlerHidesUnknownAccounts(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	var sent bytes.Buffer
+	config.Mailer = mail.NewLogSender(&sent, "no-reply@example.com")
+
+	mock.ExpectQuery("SELECT id, email, password, (.+) FROM users").
+		WithArgs("nobody@example.com").
+		WillReturnError(sql.ErrNoRows)
+
+	req := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{"email":"nobody@example.com"}`))
+	rr := httptest.NewRecorder()
+
+	ForgotPasswordHandler(rr, req)
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Empty(t, sent.String())
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestForgotPasswordHandlerLinksToResetPage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	var sent bytes.Buffer
+	config.Mailer = mail.NewLogSender(&sent, "no-reply@example.com")
+	previousURL := config.PasswordResetURL
+	config.PasswordResetURL = "https://app.example.com/reset-password"
+	defer func() { config.PasswordResetURL = previousURL }()
+
+	mock.ExpectQuery("SELECT id, email, password, (.+) FROM users").
+		WithArgs("test@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "mfa_enabled"}).
+			AddRow(4, "test@example.com", "hash", false))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM user_tokens").
+		WithArgs(4, models.TokenResetPassword).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO user_tokens").
+		WithArgs(4, models.TokenResetPassword, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	req := httptest.NewRequest(http.MethodPost, "/password/forgot", strings.NewReader(`{"email":"test@example.com"}`))
+	rr := httptest.NewRecorder()
+
+	ForgotPasswordHandler(rr, req)
+
+	assert.Equal(t, http.StatusAccepted, rr.Code)
+	assert.Contains(t, sent.String(), "https://app.example.com/reset-password?token=")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestResetPasswordHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	previousRedis := config.RedisClient
+	config.RedisClient = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer func() { config.RedisClient = previousRedis }()
+
+	session, err := utils.IssueSession(4, "test@example.com")
+	assert.NoError(t, err)
+
+	mock.ExpectQuery("UPDATE user_tokens SET used_at").
+		WithArgs(utils.HashToken("reset-token"), models.TokenResetPassword).
+		WillReturnRows(sqlmock.NewRows([]string{"user_id"}).AddRow(4))
+	mock.ExpectExec("UPDATE users SET password").
+		WithArgs(sqlmock.AnyArg(), 4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("SELECT email FROM users").
+		WithArgs(4).
+		WillReturnRows(sqlmock.NewRows([]string{"email"}).AddRow("test@example.com"))
+	mock.ExpectExec("UPDATE users SET email_verified_at").
+		WithArgs(4).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE user_tokens SET used_at").
+		WithArgs(utils.HashToken("reset-token"), models.TokenResetPassword).
+		WillReturnError(sql.ErrNoRows)
+
+	for _, want := range []int{http.StatusOK, http.StatusBadRequest} {
+		req := httptest.NewRequest(http.MethodPost, "/password/reset", strings.NewReader(`{"token":"reset-token","password":"new-password"}`))
+		rr := httptest.NewRecorder()
+
+		ResetPasswordHandler(rr, req)
+
+		assert.Equal(t, want, rr.Code)
+	}
+
+	_, err = utils.RefreshSession(session.RefreshToken)
+	assert.ErrorIs(t, err, utils.ErrInvalidRefreshToken)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"authentication/middleware"
+	"authentication/models"
+	"authentication/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+type apiKeyRequest struct {
+	Name   string   `json:"name"`
+	Scopes []string `json:"scopes"`
+}
+
+func validAPIKeyScope(scope string) bool {
+	for _, s := range middleware.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+func CreateAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	var req apiKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		http.Error(w, "API key name is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Scopes) == 0 {
+		http.Error(w, "At least one scope is required", http.StatusBadRequest)
+		return
+	}
+	for _, scope := range req.Scopes {
+		if !validAPIKeyScope(scope) {
+			http.Error(w, fmt.Sprintf("Unknown scope %q (expected one of %s)", scope, strings.Join(middleware.APIKeyScopes, ", ")), http.StatusBadRequest)
+			return
+		}
+	}
+
+	key, prefix, err := utils.GenerateAPIKey()
+	if err != nil {
+		http.Error(w, "Error generating API key", http.StatusInternalServerError)
+		return
+	}
+
+	apiKey, err := models.CreateAPIKey(userID, req.Name, prefix, utils.HashToken(key), req.Scopes)
+	if err != nil {
+		http.Error(w, "Error saving API key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	response := map[string]interface{}{
+		"api_key": apiKey,
+		"key":     key,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func ListAPIKeysHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	keys, err := models.GetAPIKeys(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving API keys: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"api_keys": keys,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func RevokeAPIKeyHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	keyID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	err = models.RevokeAPIKey(keyID, userID)
+	if errors.Is(err, models.ErrAPIKeyNotFound) {
+		http.Error(w, "API key not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error revoking API key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "API key revoked successfully")
+}
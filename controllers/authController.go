@@ -1,17 +1,25 @@
 package controllers
 
 import (
+	"authentication/middleware"
 	"authentication/models"
 	"authentication/utils"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log"
+	"math"
+	"net"
 	"net/http"
-	"time"
+	"strconv"
+	"strings"
 
-	"github.com/dgrijalva/jwt-go"
 	"golang.org/x/crypto/bcrypt"
 )
 
+const refreshCookieName = "refresh_token"
+
 type Credentials struct {
 	Email    string `json:"email"`
 	Password string `json:"password"`
@@ -30,6 +38,16 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	creds.Email = strings.TrimSpace(creds.Email)
+	if !validEmail(creds.Email) {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if creds.Password == "" {
+		http.Error(w, "Password is required", http.StatusBadRequest)
+		return
+	}
+
 	if models.UserExists(creds.Email) {
 		http.Error(w, "User already exists", http.StatusConflict)
 		return
@@ -41,14 +59,19 @@ func RegisterHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = models.CreateUser(creds.Email, string(hashedPassword))
+	userID, err := models.CreateUser(creds.Email, string(hashedPassword))
 	if err != nil {
 		http.Error(w, "Error saving user", http.StatusInternalServerError)
 		return
 	}
 
+	// The account exists either way; the user can ask for a new email later.
+	if err := sendVerificationEmail(userID, creds.Email); err != nil {
+		log.Printf("Failed to send verification email to user %d: %v", userID, err)
+	}
+
 	w.WriteHeader(http.StatusCreated)
-	fmt.Fprintln(w, "User registered successfully")
+	fmt.Fprintln(w, "User registered successfully. Check your email to verify your address.")
 }
 
 func LoginHandler(w http.ResponseWriter, r *http.Request) {
@@ -64,36 +87,194 @@ func LoginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	storedHashedPassword, err := models.GetPasswordByEmail(creds.Email)
-	if err != nil {
-		http.Error(w, "User not found", http.StatusUnauthorized)
+	ip := clientIP(r)
+	if !checkLoginThrottle(w, creds.Email, ip) {
 		return
 	}
 
-	err = bcrypt.CompareHashAndPassword([]byte(storedHashedPassword), []byte(creds.Password))
-	if err != nil {
-		http.Error(w, "Invalid credentials", http.StatusUnauthorized)
+	user, err := models.GetUserByEmail(creds.Email)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		http.Error(w, "Error retrieving user", http.StatusInternalServerError)
 		return
 	}
 
-	expirationTime := time.Now().Add(15 * time.Minute)
-	claims := &utils.Claims{
-		Email: creds.Email,
-		StandardClaims: jwt.StandardClaims{
-			ExpiresAt: expirationTime.Unix(),
-		},
+	// Compare against a dummy hash for unknown emails so the response time
+	// does not reveal whether the account exists.
+	passwordHash := dummyPasswordHash
+	if user != nil {
+		passwordHash = []byte(user.Password)
+	}
+	if bcrypt.CompareHashAndPassword(passwordHash, []byte(creds.Password)) != nil || user == nil {
+		recordLoginFailure(creds.Email, ip)
+		http.Error(w, "Invalid email or password", http.StatusUnauthorized)
+		return
+	}
+
+	if user.MFAEnabled {
+		challenge, err := utils.IssueMFAChallenge(user.ID, user.Email)
+		if err != nil {
+			http.Error(w, "Error generating token", http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusOK)
+		response := map[string]interface{}{
+			"mfa_required": true,
+			"mfa_token":    challenge,
+		}
+		json.NewEncoder(w).Encode(response)
+		return
 	}
 
-	tokenString, err := utils.GenerateJWT(claims)
+	if err := utils.ClearLoginFailures(user.Email); err != nil {
+		log.Printf("Failed to clear login failures for user %d: %v", user.ID, err)
+	}
+
+	session, err := utils.IssueSession(user.ID, user.Email)
 	if err != nil {
 		http.Error(w, "Error generating token", http.StatusInternalServerError)
 		return
 	}
 
+	setSessionCookies(w, session)
+	fmt.Fprintln(w, "Login successful")
+}
+
+var dummyPasswordHash, _ = bcrypt.GenerateFromPassword([]byte("dummy-password"), bcrypt.DefaultCost)
+
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func checkLoginThrottle(w http.ResponseWriter, email, ip string) bool {
+	wait, err := utils.LoginRetryAfter(email, ip)
+	if err != nil {
+		http.Error(w, "Error checking login attempts", http.StatusInternalServerError)
+		return false
+	}
+	if wait > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+		http.Error(w, "Too many failed login attempts, try again later", http.StatusTooManyRequests)
+		return false
+	}
+	return true
+}
+
+func recordLoginFailure(email, ip string) {
+	if err := utils.RecordLoginFailure(email, ip); err != nil {
+		log.Printf("Failed to record login failure: %v", err)
+	}
+}
+
+func setSessionCookies(w http.ResponseWriter, session *utils.Session) {
 	http.SetCookie(w, &http.Cookie{
 		Name:    "token",
-		Value:   tokenString,
-		Expires: expirationTime,
+		Value:   session.AccessToken,
+		Expires: session.AccessExpiresAt,
 	})
-	fmt.Fprintln(w, "Login successful")
+	http.SetCookie(w, &http.Cookie{
+		Name:     refreshCookieName,
+		Value:    session.RefreshToken,
+		Path:     "/",
+		Expires:  session.RefreshExpiresAt,
+		HttpOnly: true,
+		SameSite: http.SameSiteStrictMode,
+	})
+}
+
+func clearSessionCookies(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{Name: "token", Value: "", MaxAge: -1})
+	http.SetCookie(w, &http.Cookie{Name: refreshCookieName, Value: "", Path: "/", MaxAge: -1, HttpOnly: true})
+}
+
+// refreshTokenFromRequest accepts the refresh token either from its cookie or
+// as {"refresh_token": "..."} in the request body for non-browser clients.
+func refreshTokenFromRequest(r *http.Request) string {
+	if cookie, err := r.Cookie(refreshCookieName); err == nil && cookie.Value != "" {
+		return cookie.Value
+	}
+	var body struct {
+		RefreshToken string `json:"refresh_token"`
+	}
+	if r.Body != nil && json.NewDecoder(r.Body).Decode(&body) == nil {
+		return body.RefreshToken
+	}
+	return ""
+}
+
+func RefreshTokenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	refreshToken := refreshTokenFromRequest(r)
+	if refreshToken == "" {
+		http.Error(w, "Missing refresh token", http.StatusUnauthorized)
+		return
+	}
+
+	session, err := utils.RefreshSession(refreshToken)
+	if errors.Is(err, utils.ErrInvalidRefreshToken) {
+		clearSessionCookies(w)
+		http.Error(w, "Invalid refresh token", http.StatusUnauthorized)
+		return
+	} else if err != nil {
+		http.Error(w, "Error refreshing token", http.StatusInternalServerError)
+		return
+	}
+
+	setSessionCookies(w, session)
+	fmt.Fprintln(w, "Token refreshed")
+}
+
+func LogoutHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	if err := utils.RevokeToken(principal.TokenID, principal.ExpiresAt); err != nil {
+		http.Error(w, "Error revoking token", http.StatusInternalServerError)
+		return
+	}
+	if refreshToken := refreshTokenFromRequest(r); refreshToken != "" {
+		if err := utils.RevokeRefreshToken(refreshToken); err != nil {
+			http.Error(w, "Error revoking token", http.StatusInternalServerError)
+			return
+		}
+	}
+
+	clearSessionCookies(w)
+	fmt.Fprintln(w, "Logged out")
+}
+
+func JWKSHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(utils.JWKS())
+}
+
+func requestUserID(w http.ResponseWriter, r *http.Request) (int, bool) {
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return 0, false
+	}
+	return principal.UserID, true
 }
@@ -2,6 +2,9 @@ package controllers
 
 import (
 	"authentication/config"
+	"authentication/mail"
+	"authentication/models"
+	"bytes"
 	"database/sql"
 	"log"
 	"net/http"
@@ -11,7 +14,10 @@ import (
 	"testing"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
 	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
 )
 
 func TestMain(m *testing.M) {
@@ -20,6 +26,7 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Fatalf("failed to connect to database: %v", err)
 	}
+	config.RedisClient = redis.NewClient(&redis.Options{Addr: "127.0.0.1:0", MaxRetries: -1})
 
 	code := m.Run()
 
@@ -38,6 +45,20 @@ func TestRegisterHandler(t *testing.T) {
 	mock.ExpectQuery("SELECT EXISTS").
 		WithArgs("test@example.com").
 		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(false))
+	mock.ExpectQuery("INSERT INTO users").
+		WithArgs("test@example.com", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectBegin()
+	mock.ExpectExec("DELETE FROM user_tokens").
+		WithArgs(1, models.TokenVerifyEmail).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("INSERT INTO user_tokens").
+		WithArgs(1, models.TokenVerifyEmail, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	var sent bytes.Buffer
+	config.Mailer = mail.NewLogSender(&sent, "no-reply@example.com")
 
 	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"email":"test@example.com","password":"hashed_password"}`))
 	req.Header.Set("Content-Type", "application/json")
@@ -46,7 +67,76 @@ func TestRegisterHandler(t *testing.T) {
 
 	RegisterHandler(rr, req)
 
-	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Contains(t, sent.String(), "To: test@example.com")
+	assert.Contains(t, sent.String(), config.BaseURL+"/verify-email?token=")
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestRegisterHandlerRejectsInvalidEmail(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/register", strings.NewReader(`{"email":"not an email","password":"secret"}`))
+	rr := httptest.NewRecorder()
+
+	RegisterHandler(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestLoginHandlerUniformErrors(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	previousRedis := config.RedisClient
+	config.RedisClient = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer func() { config.RedisClient = previousRedis }()
+
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery("SELECT id, email, password, (.+) FROM users").
+		WithArgs("nobody@example.com").
+		WillReturnError(sql.ErrNoRows)
+	mock.ExpectQuery("SELECT id, email, password, (.+) FROM users").
+		WithArgs("test@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "mfa_enabled"}).
+			AddRow(1, "test@example.com", string(hashedPassword), false))
+
+	var bodies []string
+	for _, email := range []string{"nobody@example.com", "test@example.com"} {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"`+email+`","password":"wrong"}`))
+		rr := httptest.NewRecorder()
+
+		LoginHandler(rr, req)
+
+		assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		bodies = append(bodies, rr.Body.String())
+	}
+	assert.Equal(t, bodies[0], bodies[1])
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT id, email, password, (.+) FROM users").
+			WithArgs("test@example.com").
+			WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "mfa_enabled"}).
+				AddRow(1, "test@example.com", string(hashedPassword), false))
+	}
+	for i := 0; i < 2; i++ {
+		req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"test@example.com","password":"wrong"}`))
+		LoginHandler(httptest.NewRecorder(), req)
+	}
+
+	// The third failure for the account triggers a backoff.
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"test@example.com","password":"password"}`))
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, req)
+	assert.Equal(t, http.StatusTooManyRequests, rr.Code)
+	assert.Equal(t, "1", rr.Header().Get("Retry-After"))
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -3,19 +3,24 @@ package controllers
 import (
 	"authentication/config"
 	"authentication/models"
+	"authentication/storage"
 	"authentication/utils"
+	"bufio"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
 	"net/http"
-	"net/url"
 	"path/filepath"
 	"strconv"
-	"strings"
 	"time"
 
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/go-redis/redis/v8"
+	"github.com/gorilla/mux"
 )
 
 const fileCacheExpiration = 5 * time.Minute
@@ -24,69 +29,362 @@ func getFileCacheKey(fileID int) string {
 	return fmt.Sprintf("file_metadata_%d", fileID)
 }
 
-func UploadFileHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
-		return
+// maxFormFieldBytes bounds the non-file fields of an upload form, which are
+// read into memory.
+const maxFormFieldBytes = 4 << 10
+
+var errUploadQuotaExceeded = errors.New("storage quota exceeded")
+
+type uploadOptions struct {
+	userID         int
+	ownerID        int
+	folderID       *int
+	existingFileID *int
+	expiryDate     sql.NullTime
+	// remaining is how many more bytes the owner may store.
+	remaining int64
+}
+
+type uploadResult struct {
+	FileURL       string `json:"fileURL"`
+	FileID        int    `json:"fileID"`
+	Version       int    `json:"version"`
+	FileName      string `json:"fileName"`
+	FileSize      int64  `json:"fileSize"`
+	MimeType      string `json:"mimeType"`
+	ScanStatus    string `json:"scanStatus"`
+	ContentSHA256 string `json:"contentSHA256"`
+}
+
+// uploadReader counts the bytes streamed from a file part and fails the
+// read once the owner's remaining quota is used up. It records the first
+// read error because storage backends may wrap it beyond recognition.
+type uploadReader struct {
+	r     io.Reader
+	n     int64
+	limit int64
+	err   error
+}
+
+func (u *uploadReader) Read(p []byte) (int, error) {
+	n, err := u.r.Read(p)
+	u.n += int64(n)
+	if u.n > u.limit {
+		u.err = errUploadQuotaExceeded
+		return n, u.err
+	}
+	if err != nil && err != io.EOF && u.err == nil {
+		u.err = err
+	}
+	return n, err
+}
+
+func writeUploadReadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	switch {
+	case errors.As(err, &tooLarge):
+		http.Error(w, fmt.Sprintf("Upload exceeds the maximum size of %d bytes", tooLarge.Limit), http.StatusRequestEntityTooLarge)
+	case errors.Is(err, errUploadQuotaExceeded):
+		http.Error(w, "Storage quota exceeded", http.StatusRequestEntityTooLarge)
+	default:
+		http.Error(w, "Error reading upload: "+err.Error(), http.StatusBadRequest)
 	}
+}
+
+// resolveUploadOptions validates the form fields sent ahead of the first
+// file part.
+func resolveUploadOptions(w http.ResponseWriter, userID int, fields map[string]string) (*uploadOptions, bool) {
+	opts := &uploadOptions{userID: userID, ownerID: userID}
 
-	cookie, err := r.Cookie("token")
+	var err error
+	opts.folderID, err = parseOptionalID(fields["folder_id"])
 	if err != nil {
-		http.Error(w, "No token found in cookies", http.StatusUnauthorized)
-		return
+		http.Error(w, "Invalid folder_id", http.StatusBadRequest)
+		return nil, false
 	}
 
-	userID, err := utils.GetUserIdFromToken(cookie.Value)
+	opts.existingFileID, err = parseOptionalID(fields["file_id"])
 	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
-		return
+		http.Error(w, "Invalid file_id", http.StatusBadRequest)
+		return nil, false
+	}
+	if opts.existingFileID != nil {
+		existing, ok := authorizeFile(w, *opts.existingFileID, userID, models.PermissionWrite)
+		if !ok {
+			return nil, false
+		}
+		// New versions are charged to the file's owner, not the uploader.
+		// Earlier versions are kept, so nothing is credited back for them.
+		opts.ownerID = existing.UserID
 	}
 
-	err = r.ParseMultipartForm(10 << 20)
+	if opts.folderID != nil {
+		if _, err := models.GetFolder(userID, *opts.folderID); err != nil {
+			writeFolderError(w, err)
+			return nil, false
+		}
+	}
+
+	var ok bool
+	opts.expiryDate, ok, err = parseRetention(fields["retention"], fields["expires_at"])
 	if err != nil {
-		http.Error(w, "Error parsing form data: "+err.Error(), http.StatusBadRequest)
-		return
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	if !ok {
+		opts.expiryDate, err = defaultExpiry(userID)
+		if err != nil {
+			http.Error(w, "Error retrieving retention policy: "+err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
 	}
 
-	file, handler, err := r.FormFile("file")
+	usage, err := models.GetStorageUsage(opts.ownerID)
 	if err != nil {
-		http.Error(w, "Error retrieving the file: "+err.Error(), http.StatusBadRequest)
-		return
+		http.Error(w, "Error checking storage quota: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
 	}
-	defer file.Close()
+	opts.remaining = usage.QuotaBytes - usage.UsedBytes
+	if opts.remaining <= 0 {
+		http.Error(w, fmt.Sprintf("Storage quota exceeded: %d of %d bytes used", usage.UsedBytes, usage.QuotaBytes), http.StatusRequestEntityTooLarge)
+		return nil, false
+	}
+	return opts, true
+}
+
+// storeUploadedPart sniffs the content type of one file part, streams it
+// into storage while hashing it, verifies any checksums the client supplied
+// and records it either as a new file or as a new version of an existing
+// one.
+func storeUploadedPart(w http.ResponseWriter, r *http.Request, opts *uploadOptions, part *multipart.Part, expected *expectedChecksums) (*uploadResult, bool) {
+	fileName := part.FileName()
 
-	fileSize := handler.Size
-	fileName := handler.Filename
-	fileExtension := filepath.Ext(fileName)
-	encodedFileName := url.PathEscape(fileName)
+	content := bufio.NewReaderSize(part, utils.SniffLength)
+	head, err := content.Peek(utils.SniffLength)
+	if err != nil && err != io.EOF {
+		writeUploadReadError(w, err)
+		return nil, false
+	}
+	mimeType := utils.DetectMIMEType(head)
+	if !checkMIMEPolicy(w, mimeType) {
+		return nil, false
+	}
 
-	uploadInput := &s3manager.UploadInput{
-		Bucket: aws.String("go-file-management-system-bucket"),
-		Key:    aws.String(encodedFileName),
-		Body:   file,
+	objectKey, err := storage.NewObjectKey(opts.userID, fileName)
+	if err != nil {
+		http.Error(w, "Error generating object key: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
 	}
 
-	_, err = config.S3Uploader.Upload(uploadInput)
+	digest := newContentDigest()
+	body := &uploadReader{r: io.TeeReader(content, digest), limit: opts.remaining}
+	err = config.Storage.Put(r.Context(), objectKey, body, mimeType)
+	if body.err != nil {
+		config.Storage.Delete(r.Context(), objectKey)
+		writeUploadReadError(w, body.err)
+		return nil, false
+	}
 	if err != nil {
-		http.Error(w, "Error uploading file to S3: "+err.Error(), http.StatusInternalServerError)
-		return
+		http.Error(w, "Error uploading file to storage: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if err := expected.verify(digest); err != nil {
+		config.Storage.Delete(r.Context(), objectKey)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
 	}
+	opts.remaining -= body.n
 
-	fileURL := "https://go-file-management-system-bucket.s3.eu-north-1.amazonaws.com/" + encodedFileName
-	expiryDate := time.Now().Add(1 * time.Minute)
+	return recordUpload(w, r, opts, objectKey, fileName, mimeType, body.n, digest.SHA256())
+}
 
-	fileID, err := models.SaveFileMetadata(userID, fileName, int(fileSize), fileURL, fileExtension, false, expiryDate)
+// recordUpload saves a stored object either as a new file or as a new
+// version of an existing one. Content that is already stored is shared with
+// its existing blob and the new copy deleted. The object is deleted if
+// recording fails. Either way the file is held back from downloads and
+// sharing until the malware scan passes.
+func recordUpload(w http.ResponseWriter, r *http.Request, opts *uploadOptions, objectKey, fileName, mimeType string, size int64, contentSHA256 string) (*uploadResult, bool) {
+	storedKey, err := models.AcquireBlob(contentSHA256, objectKey, size)
 	if err != nil {
+		config.Storage.Delete(r.Context(), objectKey)
+		http.Error(w, "Error saving file content: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if storedKey != objectKey {
+		config.Storage.Delete(r.Context(), objectKey)
+	}
+
+	result := &uploadResult{
+		FileURL:       config.Storage.URL(storedKey),
+		FileName:      fileName,
+		FileSize:      size,
+		MimeType:      mimeType,
+		ScanStatus:    models.ScanStatusPending,
+		ContentSHA256: contentSHA256,
+	}
+
+	if opts.existingFileID != nil {
+		result.FileID = *opts.existingFileID
+		result.Version, err = models.AddFileVersion(*opts.existingFileID, storedKey, result.FileURL, int(size), contentSHA256, mimeType)
+		if err != nil {
+			releaseObject(r.Context(), storedKey)
+			http.Error(w, "Error saving file version: "+err.Error(), http.StatusInternalServerError)
+			return nil, false
+		}
+
+		config.RedisClient.Del(config.Ctx, getFileCacheKey(*opts.existingFileID))
+		config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", opts.ownerID))
+		return result, true
+	}
+
+	result.Version = 1
+	result.FileID, err = models.SaveFileMetadata(&models.FileMetadata{
+		UserID:     opts.userID,
+		FolderID:   opts.folderID,
+		FileName:   fileName,
+		FileSize:   int(size),
+		FileURL:    result.FileURL,
+		ObjectKey:  storedKey,
+		FileType:   filepath.Ext(fileName),
+		MimeType:   mimeType,
+		ScanStatus: models.ScanStatusPending,
+		SHA256:     contentSHA256,
+		ExpiryDate: opts.expiryDate,
+	})
+	if err != nil {
+		releaseObject(r.Context(), storedKey)
 		http.Error(w, "Error saving file metadata: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", opts.userID))
+	return result, true
+}
+
+// releaseObject drops a blob reference that was taken for a file that could
+// not be saved, deleting the object if nothing else refers to it.
+func releaseObject(ctx context.Context, objectKey string) {
+	orphaned, err := models.ReleaseBlob(objectKey)
+	if err == nil && orphaned {
+		config.Storage.Delete(ctx, objectKey)
+	}
+}
+
+// UploadFileHandler streams multipart uploads straight into storage. Form
+// fields (folder_id, file_id, retention, expires_at) must precede the file
+// parts, and any number of "file" parts may follow unless file_id is set.
+// Each part may carry Content-MD5 or X-Checksum-SHA256 headers; when they
+// are set on the request instead, only a single file may be sent.
+func UploadFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", userID))
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requireVerifiedEmail(w, userID) {
+		return
+	}
+
+	if r.ContentLength > config.MaxUploadBytes {
+		http.Error(w, fmt.Sprintf("Upload exceeds the maximum size of %d bytes", config.MaxUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+	r.Body = http.MaxBytesReader(w, r.Body, config.MaxUploadBytes)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		http.Error(w, "Error parsing form data: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	requestChecksums, err := parseChecksums(r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	fields := map[string]string{}
+	var opts *uploadOptions
+	results := []uploadResult{}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			writeUploadReadError(w, err)
+			return
+		}
+
+		if part.FileName() == "" {
+			if opts != nil {
+				http.Error(w, "Form fields must come before the file parts", http.StatusBadRequest)
+				return
+			}
+			value, err := io.ReadAll(io.LimitReader(part, maxFormFieldBytes+1))
+			if err != nil {
+				writeUploadReadError(w, err)
+				return
+			}
+			if len(value) > maxFormFieldBytes {
+				http.Error(w, "Form field "+part.FormName()+" is too large", http.StatusBadRequest)
+				return
+			}
+			fields[part.FormName()] = string(value)
+			continue
+		}
+
+		if part.FormName() != "file" {
+			http.Error(w, "Unexpected file field "+part.FormName(), http.StatusBadRequest)
+			return
+		}
+
+		if opts == nil {
+			opts, ok = resolveUploadOptions(w, userID, fields)
+			if !ok {
+				return
+			}
+		} else if opts.existingFileID != nil {
+			http.Error(w, "Only one file can be uploaded as a new version", http.StatusBadRequest)
+			return
+		}
+
+		expected, err := parseChecksums(http.Header(part.Header))
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		if expected == nil && requestChecksums != nil {
+			if len(results) > 0 {
+				http.Error(w, "Checksum headers on the request only apply to a single file; set them on each part instead", http.StatusBadRequest)
+				return
+			}
+			expected = requestChecksums
+		}
+
+		result, ok := storeUploadedPart(w, r, opts, part, expected)
+		if !ok {
+			return
+		}
+		results = append(results, *result)
+	}
+
+	if len(results) == 0 {
+		http.Error(w, "Error retrieving the file: no file part in request", http.StatusBadRequest)
+		return
+	}
 
+	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
+	if len(results) == 1 {
+		json.NewEncoder(w).Encode(results[0])
+		return
+	}
 	response := map[string]interface{}{
-		"fileURL": fileURL,
-		"fileID":  fileID,
+		"files": results,
 	}
 	json.NewEncoder(w).Encode(response)
 }
@@ -97,15 +395,8 @@ func GetUserFilesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cookie, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "No token found in cookies", http.StatusUnauthorized)
-		return
-	}
-
-	userID, err := utils.GetUserIdFromToken(cookie.Value)
-	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
@@ -143,15 +434,8 @@ func RenameFileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cookie, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "No token found in cookies", http.StatusUnauthorized)
-		return
-	}
-
-	userID, err := utils.GetUserIdFromToken(cookie.Value)
-	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
@@ -164,14 +448,19 @@ func RenameFileHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	err = models.UpdateFileName(userID, fileID, newName)
+	file, ok := authorizeFile(w, fileID, userID, models.PermissionWrite)
+	if !ok {
+		return
+	}
+
+	err = models.UpdateFileName(fileID, newName)
 	if err != nil {
 		http.Error(w, "Error updating file name: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
 	config.RedisClient.Del(config.Ctx, getFileCacheKey(fileID))
-	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", userID))
+	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", file.UserID))
 
 	w.WriteHeader(http.StatusOK)
 	fmt.Fprintln(w, "File renamed successfully")
@@ -183,15 +472,8 @@ func SearchUserFilesHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	cookie, err := r.Cookie("token")
-	if err != nil {
-		http.Error(w, "No token found in cookies", http.StatusUnauthorized)
-		return
-	}
-
-	userID, err := utils.GetUserIdFromToken(cookie.Value)
-	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
@@ -228,106 +510,206 @@ func SearchUserFilesHandler(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(response)
 }
 
-func ShareFileHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
+func DownloadFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	cookie, err := r.Cookie("token")
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "No token found in cookies", http.StatusUnauthorized)
+		http.Error(w, "Invalid file_id", http.StatusBadRequest)
 		return
 	}
 
-	userID, err := utils.GetUserIdFromToken(cookie.Value)
-	if err != nil {
-		http.Error(w, "Invalid token", http.StatusUnauthorized)
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	fileIDStr := r.URL.Query().Get("id")
-	if fileIDStr == "" {
-		http.Error(w, "Missing file_id", http.StatusBadRequest)
+	file, ok := authorizeFile(w, fileID, userID, models.PermissionRead)
+	if !ok {
+		return
+	}
+	if !requireCleanScan(w, file.ScanStatus) {
 		return
 	}
 
-	fileID, err := strconv.Atoi(fileIDStr)
-	if err != nil {
-		http.Error(w, "Invalid file_id", http.StatusBadRequest)
+	serveStoredObject(w, r, file.FileName, file.FileType, file.MimeType, file.ObjectKey, file.SHA256, file.UploadDate)
+}
+
+// serveStoredObject picks the Content-Type sniffed at upload, falling back to
+// the file extension and then to the storage metadata for files stored
+// before sniffing. Browsers are told not to second-guess it.
+func serveStoredObject(w http.ResponseWriter, r *http.Request, fileName, fileType, mimeType, objectKey, contentSHA256 string, modTime time.Time) {
+	info, err := config.Storage.Stat(r.Context(), objectKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "File content not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error reading file from storage: "+err.Error(), http.StatusInternalServerError)
 		return
 	}
 
-	now := time.Now()
+	content := storage.NewObjectReader(r.Context(), config.Storage, objectKey, info.Size)
+	defer content.Close()
 
-	err = models.UpdateSharedStatus(fileID, userID, true, now)
-	if err != nil {
-		http.Error(w, "Error updating shared status: "+err.Error(), http.StatusInternalServerError)
+	contentType := mimeType
+	if contentType == "" {
+		contentType = mime.TypeByExtension(fileType)
+	}
+	if contentType == "" {
+		contentType = info.ContentType
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": fileName}))
+	if contentSHA256 != "" {
+		w.Header().Set("ETag", `"`+contentSHA256+`"`)
+		w.Header().Set("Digest", digestHeader(contentSHA256))
+	}
+
+	// ServeContent handles Range, If-Range, If-None-Match and
+	// If-Modified-Since, answering with 206 or 304 where appropriate.
+	http.ServeContent(w, r, fileName, modTime, content)
+}
+
+func MoveFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	tempLink := fmt.Sprintf("http://localhost:8080/share/%d", fileID)
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
 
-	err = models.SetTemporaryLinkExpiry(fileID, 1*time.Minute)
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "Error setting temporary link expiry: "+err.Error(), http.StatusInternalServerError)
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
+	folderID, err := parseOptionalID(r.URL.Query().Get("folder_id"))
+	if err != nil {
+		http.Error(w, "Invalid folder_id", http.StatusBadRequest)
+		return
+	}
+
+	if folderID != nil {
+		if _, err := models.GetFolder(userID, *folderID); err != nil {
+			writeFolderError(w, err)
+			return
+		}
+	}
+
+	err = models.MoveFile(userID, fileID, folderID)
+	if errors.Is(err, models.ErrFileNotFound) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error moving file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", userID))
+
 	w.WriteHeader(http.StatusOK)
-	response := map[string]interface{}{
-		"link": tempLink,
+	fmt.Fprintln(w, "File moved successfully")
+}
+
+// copyStoredObject gives a copy its own reference to the original's blob.
+// Files stored before content hashing have no blob and are copied in
+// storage instead.
+func copyStoredObject(ctx context.Context, userID int, file *models.FileMetadata) (string, error) {
+	if file.SHA256 != "" {
+		return models.AcquireBlob(file.SHA256, file.ObjectKey, int64(file.FileSize))
 	}
-	json.NewEncoder(w).Encode(response)
+
+	objectKey, err := storage.NewObjectKey(userID, file.FileName)
+	if err != nil {
+		return "", err
+	}
+	if err := config.Storage.Copy(ctx, file.ObjectKey, objectKey, ""); err != nil {
+		return "", err
+	}
+	return objectKey, nil
 }
 
-func AccessSharedFileHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodGet {
+func CopyFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
 		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
 		return
 	}
 
-	fileIDStr := strings.TrimPrefix(r.URL.Path, "/share/")
-	fileID, err := strconv.Atoi(fileIDStr)
-	if err != nil || fileIDStr == "" {
-		http.Error(w, "Invalid file_id", http.StatusBadRequest)
+	userID, ok := requestUserID(w, r)
+	if !ok {
 		return
 	}
 
-	file, err := models.GetFileByID(fileID)
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
 	if err != nil {
-		http.Error(w, "File not found", http.StatusNotFound)
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
 		return
 	}
 
-	if !file.SharedUser {
-		http.Error(w, "File is not shared or the link has expired", http.StatusUnauthorized)
+	folderID, err := parseOptionalID(r.URL.Query().Get("folder_id"))
+	if err != nil {
+		http.Error(w, "Invalid folder_id", http.StatusBadRequest)
 		return
 	}
 
-	if file.SharedAt.Valid {
-		if time.Since(file.SharedAt.Time) > 1*time.Minute {
-			err := models.UpdateSharedStatus(fileID, file.UserID, false, time.Now())
-			if err != nil {
-				http.Error(w, "Error revoking shared status", http.StatusInternalServerError)
-				return
-			}
-			http.Error(w, "The file sharing link has expired", http.StatusUnauthorized)
+	file, ok := authorizeFile(w, fileID, userID, models.PermissionRead)
+	if !ok {
+		return
+	}
+	if !requireCleanScan(w, file.ScanStatus) {
+		return
+	}
+
+	if folderID != nil {
+		if _, err := models.GetFolder(userID, *folderID); err != nil {
+			writeFolderError(w, err)
 			return
 		}
-	} else {
-		http.Error(w, "File sharing link has expired", http.StatusUnauthorized)
+	}
+
+	if !checkQuota(w, userID, int64(file.FileSize)) {
 		return
 	}
 
+	objectKey, err := copyStoredObject(r.Context(), userID, file)
+	if err != nil {
+		http.Error(w, "Error copying file in storage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	copied := *file
+	copied.UserID = userID
+	copied.FolderID = folderID
+	copied.ObjectKey = objectKey
+	copied.FileURL = config.Storage.URL(objectKey)
+	copied.SharedUser = false
+
+	copiedID, err := models.SaveFileMetadata(&copied)
+	if err != nil {
+		releaseObject(r.Context(), objectKey)
+		http.Error(w, "Error saving file metadata: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", userID))
+
 	w.Header().Set("Content-Type", "application/json")
-	w.WriteHeader(http.StatusOK)
+	w.WriteHeader(http.StatusCreated)
 	response := map[string]interface{}{
-		"file_name": file.FileName,
-		"s3_url":    file.FileURL,
-		"file_size": file.FileSize,
-		"file_type": file.FileType,
+		"fileURL": copied.FileURL,
+		"fileID":  copiedID,
 	}
 	json.NewEncoder(w).Encode(response)
 }
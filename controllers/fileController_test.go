@@ -2,15 +2,57 @@ package controllers
 
 import (
 	"authentication/config"
+	"authentication/middleware"
+	"authentication/models"
+	"authentication/storage"
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
 	"github.com/stretchr/testify/assert"
 )
 
+func withPrincipal(req *http.Request, userID int) *http.Request {
+	principal := &middleware.Principal{UserID: userID, Email: "test@example.com", Scopes: []string{middleware.ScopeAll}}
+	return req.WithContext(middleware.WithPrincipal(req.Context(), principal))
+}
+
+func expectVerifiedEmail(mock sqlmock.Sqlmock, userID int, verified bool) {
+	mock.ExpectQuery("SELECT email_verified_at IS NOT NULL FROM users").
+		WithArgs(userID).
+		WillReturnRows(sqlmock.NewRows([]string{"verified"}).AddRow(verified))
+}
+
+func expectStorageUsage(mock sqlmock.Sqlmock, userID int, quota, used int64) {
+	mock.ExpectQuery("SELECT COALESCE\\(u.quota_bytes").
+		WithArgs(userID, config.DefaultQuotaBytes).
+		WillReturnRows(sqlmock.NewRows([]string{"quota_bytes", "used_bytes", "file_count"}).AddRow(quota, used, 0))
+}
+
+// expectBlob expects a reference to be taken on the blob for content and
+// answers with storedKey as the object holding it.
+func expectBlob(mock sqlmock.Sqlmock, contentSHA256 string, storedKey interface{}) {
+	mock.ExpectQuery("INSERT INTO blobs").
+		WithArgs(sqlmock.AnyArg(), contentSHA256, sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"object_key"}).AddRow(storedKey))
+}
+
+func expectMIMERules(mock sqlmock.Sqlmock, rules ...models.MIMERule) {
+	rows := sqlmock.NewRows([]string{"id", "pattern", "action", "created_at"})
+	for _, rule := range rules {
+		rows.AddRow(rule.ID, rule.Pattern, rule.Action, time.Now())
+	}
+	mock.ExpectQuery("SELECT (.+) FROM mime_policy_rules").WillReturnRows(rows)
+}
+
 func TestUploadFileHandler(t *testing.T) {
 	db, mock, err := sqlmock.New()
 	if err != nil {
@@ -19,18 +61,460 @@ func TestUploadFileHandler(t *testing.T) {
 	config.DB = db
 	defer db.Close()
 
-	mock.ExpectExec("INSERT INTO files").
-		WithArgs("user_id", "file_name", "file_size", "file_url", "file_extension", false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+
+	expectVerifiedEmail(mock, 1, true)
+	mock.ExpectQuery("SELECT default_retention_seconds FROM users").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"default_retention_seconds"}).AddRow(nil))
+	expectStorageUsage(mock, 1, 100, 0)
+	expectMIMERules(mock)
+	expectBlob(mock, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", "1/stored.txt")
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO files").
+		WithArgs(1, nil, "testfile.txt", 11, sqlmock.AnyArg(), sqlmock.AnyArg(), ".txt", "text/plain", "pending", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO file_versions").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "text/plain", "pending").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "testfile.txt")
+	part.Write([]byte("hello world"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = withPrincipal(req, 1)
+
+	rr := httptest.NewRecorder()
+
+	UploadFileHandler(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUploadFileHandlerDeduplicatesContent(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+	assert.NoError(t, backend.Put(context.Background(), "2/existing.txt", strings.NewReader("hello world"), "text/plain"))
+
+	expectVerifiedEmail(mock, 1, true)
+	mock.ExpectQuery("SELECT default_retention_seconds FROM users").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"default_retention_seconds"}).AddRow(nil))
+	expectStorageUsage(mock, 1, 100, 0)
+	expectMIMERules(mock)
+	expectBlob(mock, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", "2/existing.txt")
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO files").
+		WithArgs(1, nil, "testfile.txt", 11, backend.URL("2/existing.txt"), "2/existing.txt", ".txt", "text/plain", "pending", sqlmock.AnyArg(), false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO file_versions").
+		WithArgs(1, "2/existing.txt", sqlmock.AnyArg(), sqlmock.AnyArg(), "text/plain", "pending").
 		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "testfile.txt")
+	part.Write([]byte("hello world"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = withPrincipal(req, 1)
+
+	rr := httptest.NewRecorder()
+
+	UploadFileHandler(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	objects, err := backend.List(req.Context(), "")
+	assert.NoError(t, err)
+	if assert.Len(t, objects, 1) {
+		assert.Equal(t, "2/existing.txt", objects[0].Key)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUploadFileHandlerRejectsOverQuota(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	root := t.TempDir()
+	backend, err := storage.NewLocalBackend(root)
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+
+	expectVerifiedEmail(mock, 1, true)
+	mock.ExpectQuery("SELECT default_retention_seconds FROM users").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"default_retention_seconds"}).AddRow(nil))
+	expectStorageUsage(mock, 1, 100, 95)
+	expectMIMERules(mock)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "testfile.txt")
+	part.Write([]byte("hello world"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = withPrincipal(req, 1)
+
+	rr := httptest.NewRecorder()
+
+	UploadFileHandler(rr, req)
+
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Storage quota exceeded")
+
+	objects, err := backend.List(req.Context(), "")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUploadFileHandlerRejectsDeniedMIMEType(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+
+	expectVerifiedEmail(mock, 1, true)
+	mock.ExpectQuery("SELECT default_retention_seconds FROM users").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"default_retention_seconds"}).AddRow(nil))
+	expectStorageUsage(mock, 1, 1<<20, 0)
+	expectMIMERules(mock, models.MIMERule{ID: 1, Pattern: "application/x-msdownload", Action: models.MIMEActionDeny})
+
+	// The extension is not trusted; the content is a Windows executable.
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	part, _ := writer.CreateFormFile("file", "invoice.pdf")
+	executable := append([]byte("MZ\x90\x00"), bytes.Repeat([]byte{0}, 1024)...)
+	copy(executable[0x3c:], "\x40\x00\x00\x00")
+	copy(executable[0x40:], "PE\x00\x00")
+	part.Write(executable)
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = withPrincipal(req, 1)
+
+	rr := httptest.NewRecorder()
+
+	UploadFileHandler(rr, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+	assert.Contains(t, rr.Body.String(), "File type application/x-msdownload is not allowed")
+
+	objects, err := backend.List(req.Context(), "")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUploadFileHandlerMultipleFiles(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
 
-	req := httptest.NewRequest(http.MethodPost, "/upload", strings.NewReader(`{"file_name":"testfile.txt","file_size":1234}`))
-	req.Header.Set("Content-Type", "application/json")
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+
+	expectVerifiedEmail(mock, 1, true)
+	expectStorageUsage(mock, 1, 100, 0)
+	for i, name := range []string{"a.txt", "b.txt"} {
+		expectMIMERules(mock)
+		expectBlob(mock, "2cf24dba5fb0a30e26e83b2ac5b9e29e1b161e5c1fa7425e73043362938b9824", "1/hello.txt")
+		mock.ExpectBegin()
+		mock.ExpectQuery("INSERT INTO files").
+			WithArgs(1, nil, name, 5, sqlmock.AnyArg(), sqlmock.AnyArg(), ".txt", "text/plain", "pending", sqlmock.AnyArg(), false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+			WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(i + 1))
+		mock.ExpectExec("INSERT INTO file_versions").
+			WithArgs(i+1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "text/plain", "pending").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	writer.WriteField("retention", "none")
+	for _, name := range []string{"a.txt", "b.txt"} {
+		part, _ := writer.CreateFormFile("file", name)
+		part.Write([]byte("hello"))
+	}
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = withPrincipal(req, 1)
 
 	rr := httptest.NewRecorder()
 
 	UploadFileHandler(rr, req)
 
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var response struct {
+		Files []uploadResult `json:"files"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&response))
+	if assert.Len(t, response.Files, 2) {
+		assert.Equal(t, "b.txt", response.Files[1].FileName)
+		assert.Equal(t, int64(5), response.Files[1].FileSize)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestUploadFileHandlerLimits(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	previousMax := config.MaxUploadBytes
+	config.MaxUploadBytes = 1 << 10
+	defer func() { config.MaxUploadBytes = previousMax }()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+
+	expectVerifiedEmail(mock, 1, true)
+	expectVerifiedEmail(mock, 1, true)
+	mock.ExpectQuery("SELECT default_retention_seconds FROM users").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"default_retention_seconds"}).AddRow(nil))
+	expectStorageUsage(mock, 1, 1<<20, 0)
+	expectMIMERules(mock)
+	expectVerifiedEmail(mock, 1, true)
+
+	var payload bytes.Buffer
+	writer := multipart.NewWriter(&payload)
+	part, _ := writer.CreateFormFile("file", "big.bin")
+	part.Write(bytes.Repeat([]byte("x"), 2<<10))
+	writer.Close()
+
+	// Rejected up front from Content-Length, then while streaming when the
+	// length is unknown.
+	for _, contentLength := range []int64{int64(payload.Len()), -1} {
+		req := httptest.NewRequest(http.MethodPost, "/upload", bytes.NewReader(payload.Bytes()))
+		req.Header.Set("Content-Type", writer.FormDataContentType())
+		req.ContentLength = contentLength
+		rr := httptest.NewRecorder()
+		UploadFileHandler(rr, withPrincipal(req, 1))
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code)
+	}
+
+	objects, err := backend.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+
+	body := &bytes.Buffer{}
+	writer = multipart.NewWriter(body)
+	writer.WriteField("folder_id", "")
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	rr := httptest.NewRecorder()
+	UploadFileHandler(rr, withPrincipal(req, 1))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func fileRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "folder_id", "file_name", "file_size", "s3_url", "object_key", "file_extension",
+		"mime_type", "scan_status", "upload_date", "content_sha256", "current_version", "shared_user", "shared_at", "expiry_date", "deleted_at"})
+}
+
+func expectDownloadableFile(mock sqlmock.Sqlmock, backend storage.Backend, uploadDate time.Time) {
+	mock.ExpectQuery("SELECT (.+) FROM files WHERE id = ").
+		WithArgs(7).
+		WillReturnRows(fileRows().
+			AddRow(7, 1, nil, "Quarterly report.pdf", 9, backend.URL("1/report.pdf"), "1/report.pdf", ".pdf", "application/pdf", "clean", uploadDate, "c0ffee", 1, false, nil, nil, nil))
+}
+
+func newDownloadRequest(t *testing.T) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "/files/7/download", nil)
+	req = mux.SetURLVars(req, map[string]string{"id": "7"})
+	req = withPrincipal(req, 1)
+	return req
+}
+
+func TestDownloadFileHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+	backend.Put(context.Background(), "1/report.pdf", strings.NewReader("pdf bytes"), "")
+
+	uploadDate := time.Date(2024, 9, 1, 12, 0, 0, 0, time.UTC)
+
+	expectDownloadableFile(mock, backend, uploadDate)
+	rr := httptest.NewRecorder()
+	DownloadFileHandler(rr, newDownloadRequest(t))
+
 	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "application/pdf", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+	assert.Equal(t, "9", rr.Header().Get("Content-Length"))
+	assert.Equal(t, `attachment; filename="Quarterly report.pdf"`, rr.Header().Get("Content-Disposition"))
+	assert.Equal(t, `"c0ffee"`, rr.Header().Get("ETag"))
+	assert.Equal(t, "sha-256=wP/u", rr.Header().Get("Digest"))
+	assert.Equal(t, "pdf bytes", rr.Body.String())
+
+	expectDownloadableFile(mock, backend, uploadDate)
+	req := newDownloadRequest(t)
+	req.Header.Set("Range", "bytes=4-")
+	rr = httptest.NewRecorder()
+	DownloadFileHandler(rr, req)
+
+	assert.Equal(t, http.StatusPartialContent, rr.Code)
+	assert.Equal(t, "bytes 4-8/9", rr.Header().Get("Content-Range"))
+	assert.Equal(t, "bytes", rr.Body.String())
+
+	expectDownloadableFile(mock, backend, uploadDate)
+	req = newDownloadRequest(t)
+	req.Header.Set("If-None-Match", `"c0ffee"`)
+	rr = httptest.NewRecorder()
+	DownloadFileHandler(rr, req)
+
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDownloadFileHandlerServesSniffedType(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+	backend.Put(context.Background(), "1/report.pdf", strings.NewReader("<html>hi</html>"), "application/pdf")
+
+	mock.ExpectQuery("SELECT (.+) FROM files WHERE id = ").
+		WithArgs(7).
+		WillReturnRows(fileRows().
+			AddRow(7, 1, nil, "Quarterly report.pdf", 15, backend.URL("1/report.pdf"), "1/report.pdf", ".pdf", "text/html; charset=utf-8", "clean", time.Now(), "c0ffee", 1, false, nil, nil, nil))
+	rr := httptest.NewRecorder()
+	DownloadFileHandler(rr, newDownloadRequest(t))
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "text/html; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Equal(t, "nosniff", rr.Header().Get("X-Content-Type-Options"))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDownloadFileHandlerRequiresCleanScan(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+	backend.Put(context.Background(), "1/report.pdf", strings.NewReader("pdf bytes"), "")
+
+	for status, code := range map[string]int{"pending": http.StatusConflict, "infected": http.StatusForbidden} {
+		mock.ExpectQuery("SELECT (.+) FROM files WHERE id = ").
+			WithArgs(7).
+			WillReturnRows(fileRows().
+				AddRow(7, 1, nil, "Quarterly report.pdf", 9, backend.URL("1/report.pdf"), "1/report.pdf", ".pdf", "application/pdf", status, time.Now(), "c0ffee", 1, false, nil, nil, nil))
+		rr := httptest.NewRecorder()
+		DownloadFileHandler(rr, newDownloadRequest(t))
+
+		assert.Equal(t, code, rr.Code, status)
+		assert.NotContains(t, rr.Body.String(), "pdf bytes")
+	}
 
 	if err := mock.ExpectationsWereMet(); err != nil {
 		t.Errorf("there were unfulfilled expectations: %s", err)
@@ -0,0 +1,220 @@
+package controllers
+
+import (
+	"authentication/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func parseOptionalID(value string) (*int, error) {
+	if value == "" {
+		return nil, nil
+	}
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return nil, fmt.Errorf("invalid id %q", value)
+	}
+	return &id, nil
+}
+
+func writeFolderError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, models.ErrFolderNotFound):
+		http.Error(w, "Folder not found", http.StatusNotFound)
+	case errors.Is(err, models.ErrFolderNotEmpty):
+		http.Error(w, "Folder is not empty", http.StatusConflict)
+	case errors.Is(err, models.ErrFolderCycle):
+		http.Error(w, "Folder cannot be moved into itself or one of its subfolders", http.StatusConflict)
+	case errors.Is(err, models.ErrFolderExists):
+		http.Error(w, "A folder with that name already exists", http.StatusConflict)
+	default:
+		http.Error(w, "Error updating folder: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func CreateFolderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	name := strings.TrimSpace(r.URL.Query().Get("name"))
+	parentID, err := parseOptionalID(r.URL.Query().Get("parent_id"))
+	if err != nil || name == "" {
+		http.Error(w, "Invalid folder name or parent_id", http.StatusBadRequest)
+		return
+	}
+
+	if parentID != nil {
+		if _, err := models.GetFolder(userID, *parentID); err != nil {
+			writeFolderError(w, err)
+			return
+		}
+	}
+
+	folder, err := models.CreateFolder(userID, parentID, name)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(folder)
+}
+
+func RenameFolderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	folderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	newName := strings.TrimSpace(r.URL.Query().Get("new_name"))
+	if err != nil || newName == "" {
+		http.Error(w, "Invalid folder ID or new name", http.StatusBadRequest)
+		return
+	}
+
+	err = models.RenameFolder(userID, folderID, newName)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Folder renamed successfully")
+}
+
+func MoveFolderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	folderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	parentID, err := parseOptionalID(r.URL.Query().Get("parent_id"))
+	if err != nil {
+		http.Error(w, "Invalid parent_id", http.StatusBadRequest)
+		return
+	}
+
+	if parentID != nil {
+		if _, err := models.GetFolder(userID, *parentID); err != nil {
+			writeFolderError(w, err)
+			return
+		}
+	}
+
+	err = models.MoveFolder(userID, folderID, parentID)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Folder moved successfully")
+}
+
+func DeleteFolderHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	folderID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	err = models.DeleteFolder(userID, folderID)
+	if err != nil {
+		writeFolderError(w, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Folder deleted successfully")
+}
+
+func ListFolderChildrenHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	folderID, err := parseOptionalID(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid folder ID", http.StatusBadRequest)
+		return
+	}
+
+	var folder *models.Folder
+	breadcrumbs := []models.Folder{}
+	if folderID != nil {
+		folder, err = models.GetFolder(userID, *folderID)
+		if err != nil {
+			writeFolderError(w, err)
+			return
+		}
+
+		breadcrumbs, err = models.GetFolderBreadcrumbs(userID, *folderID)
+		if err != nil {
+			http.Error(w, "Error retrieving breadcrumbs: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	folders, files, err := models.ListFolderChildren(userID, folderID)
+	if err != nil {
+		http.Error(w, "Error retrieving folder contents: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"folder":      folder,
+		"breadcrumbs": breadcrumbs,
+		"folders":     folders,
+		"files":       files,
+	}
+	json.NewEncoder(w).Encode(response)
+}
@@ -0,0 +1,121 @@
+package controllers
+
+import (
+	"authentication/models"
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"hash"
+	"net/http"
+)
+
+const checksumSHA256Header = "X-Checksum-SHA256"
+
+// expectedChecksums holds the digests a client sent with some content:
+// Content-MD5 as base64 (RFC 1864) and X-Checksum-SHA256 as hex or base64.
+type expectedChecksums struct {
+	md5    []byte
+	sha256 []byte
+}
+
+func decodeDigest(value string, size int, allowHex bool) ([]byte, bool) {
+	if allowHex {
+		if digest, err := hex.DecodeString(value); err == nil && len(digest) == size {
+			return digest, true
+		}
+	}
+	if digest, err := base64.StdEncoding.DecodeString(value); err == nil && len(digest) == size {
+		return digest, true
+	}
+	return nil, false
+}
+
+// parseChecksums reads the checksum headers, returning nil when there are
+// none to verify.
+func parseChecksums(header http.Header) (*expectedChecksums, error) {
+	var expected expectedChecksums
+	if value := header.Get("Content-MD5"); value != "" {
+		digest, ok := decodeDigest(value, md5.Size, false)
+		if !ok {
+			return nil, errors.New("Content-MD5 must be a base64 encoded MD5 digest")
+		}
+		expected.md5 = digest
+	}
+	if value := header.Get(checksumSHA256Header); value != "" {
+		digest, ok := decodeDigest(value, sha256.Size, true)
+		if !ok {
+			return nil, errors.New(checksumSHA256Header + " must be a hex or base64 encoded SHA-256 digest")
+		}
+		expected.sha256 = digest
+	}
+	if expected.md5 == nil && expected.sha256 == nil {
+		return nil, nil
+	}
+	return &expected, nil
+}
+
+// contentDigest computes every digest a client may ask us to verify while
+// content streams through it.
+type contentDigest struct {
+	md5    hash.Hash
+	sha256 hash.Hash
+}
+
+func newContentDigest() *contentDigest {
+	return &contentDigest{md5: md5.New(), sha256: sha256.New()}
+}
+
+func (d *contentDigest) Write(p []byte) (int, error) {
+	d.md5.Write(p)
+	d.sha256.Write(p)
+	return len(p), nil
+}
+
+func (d *contentDigest) SHA256() string {
+	return hex.EncodeToString(d.sha256.Sum(nil))
+}
+
+func (c *expectedChecksums) verify(digest *contentDigest) error {
+	if c == nil {
+		return nil
+	}
+	if c.md5 != nil && !bytes.Equal(c.md5, digest.md5.Sum(nil)) {
+		return errors.New("Content-MD5 does not match the uploaded content")
+	}
+	if c.sha256 != nil && !bytes.Equal(c.sha256, digest.sha256.Sum(nil)) {
+		return errors.New(checksumSHA256Header + " does not match the uploaded content")
+	}
+	return nil
+}
+
+// digestHeader formats a stored hex SHA-256 as an RFC 3230 Digest value.
+func digestHeader(contentSHA256 string) string {
+	sum, err := hex.DecodeString(contentSHA256)
+	if err != nil {
+		return ""
+	}
+	return "sha-256=" + base64.StdEncoding.EncodeToString(sum)
+}
+
+// ListCorruptFilesHandler reports the file versions the integrity scrubber
+// found missing or altered in storage.
+func ListCorruptFilesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	versions, err := models.GetCorruptVersions()
+	if err != nil {
+		http.Error(w, "Error retrieving corrupt files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(versions)
+}
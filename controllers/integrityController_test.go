@@ -0,0 +1,95 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/storage"
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseChecksums(t *testing.T) {
+	header := http.Header{}
+	expected, err := parseChecksums(header)
+	assert.NoError(t, err)
+	assert.Nil(t, expected)
+
+	// MD5 and SHA-256 of "hello world".
+	header.Set("Content-MD5", "XrY7u+Ae7tCTyyK7j1rNww==")
+	header.Set(checksumSHA256Header, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9")
+	expected, err = parseChecksums(header)
+	assert.NoError(t, err)
+
+	digest := newContentDigest()
+	digest.Write([]byte("hello world"))
+	assert.NoError(t, expected.verify(digest))
+
+	digest = newContentDigest()
+	digest.Write([]byte("hello there"))
+	assert.Error(t, expected.verify(digest))
+
+	header.Set(checksumSHA256Header, "uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=")
+	_, err = parseChecksums(header)
+	assert.NoError(t, err, "base64 SHA-256 digests are accepted")
+
+	header.Set("Content-MD5", "5eb63bbbe01eeed093cb22bb8f5acdc3")
+	_, err = parseChecksums(header)
+	assert.Error(t, err, "Content-MD5 must be base64")
+}
+
+func TestUploadFileHandlerRejectsChecksumMismatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+
+	expectVerifiedEmail(mock, 1, true)
+	mock.ExpectQuery("SELECT default_retention_seconds FROM users").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"default_retention_seconds"}).AddRow(nil))
+	expectStorageUsage(mock, 1, 100, 0)
+	expectMIMERules(mock)
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", `form-data; name="file"; filename="testfile.txt"`)
+	header.Set("Content-MD5", "XrY7u+Ae7tCTyyK7j1rNww==")
+	part, _ := writer.CreatePart(header)
+	part.Write([]byte("hello there"))
+	writer.Close()
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", body)
+	req.Header.Set("Content-Type", writer.FormDataContentType())
+	req = withPrincipal(req, 1)
+
+	rr := httptest.NewRecorder()
+
+	UploadFileHandler(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Content-MD5 does not match")
+
+	objects, err := backend.List(context.Background(), "")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
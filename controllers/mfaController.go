@@ -0,0 +1,321 @@
+package controllers
+
+import (
+	"authentication/middleware"
+	"authentication/models"
+	"authentication/utils"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+)
+
+const (
+	mfaIssuer         = "File Management System"
+	recoveryCodeCount = 10
+)
+
+var errInvalidSecondFactor = errors.New("invalid authentication code")
+
+type mfaRequest struct {
+	MFAToken     string `json:"mfa_token"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recovery_code"`
+}
+
+// verifySecondFactor accepts either a current TOTP code or an unused
+// recovery code.
+func verifySecondFactor(userID int, secret string, req mfaRequest) error {
+	switch {
+	case req.Code != "":
+		step, ok := utils.ValidateTOTP(secret, req.Code, time.Now())
+		if !ok {
+			return errInvalidSecondFactor
+		}
+		return models.RecordTOTPStep(userID, step)
+	case req.RecoveryCode != "":
+		return models.ConsumeRecoveryCode(userID, utils.HashToken(utils.NormalizeRecoveryCode(req.RecoveryCode)))
+	}
+	return errInvalidSecondFactor
+}
+
+// checkSecondFactor verifies a second factor under the same per-account
+// lockout as passwords, so codes cannot be guessed through any endpoint that
+// accepts them.
+func checkSecondFactor(w http.ResponseWriter, r *http.Request, userID int, email, secret string, req mfaRequest) bool {
+	ip := clientIP(r)
+	if !checkLoginThrottle(w, email, ip) {
+		return false
+	}
+	if err := verifySecondFactor(userID, secret, req); err != nil {
+		recordLoginFailure(email, ip)
+		writeSecondFactorError(w, err)
+		return false
+	}
+	return true
+}
+
+func writeSecondFactorError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, errInvalidSecondFactor), errors.Is(err, models.ErrTOTPCodeReused), errors.Is(err, models.ErrRecoveryCodeInvalid):
+		http.Error(w, "Invalid authentication code", http.StatusUnauthorized)
+	default:
+		http.Error(w, "Error verifying authentication code: "+err.Error(), http.StatusInternalServerError)
+	}
+}
+
+func newRecoveryCodes() ([]string, []string, error) {
+	codes, err := utils.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		return nil, nil, err
+	}
+	hashes := make([]string, len(codes))
+	for i, code := range codes {
+		hashes[i] = utils.HashToken(code)
+	}
+	return codes, hashes, nil
+}
+
+func LoginMFAHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Only POST method is allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req mfaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := utils.ParseMFAChallenge(req.MFAToken)
+	if err != nil {
+		http.Error(w, "Invalid or expired MFA challenge", http.StatusUnauthorized)
+		return
+	}
+
+	state, err := models.GetTOTPState(claims.UserID)
+	if err != nil {
+		http.Error(w, "Error retrieving account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !state.Enabled {
+		http.Error(w, "Invalid or expired MFA challenge", http.StatusUnauthorized)
+		return
+	}
+
+	if !checkSecondFactor(w, r, claims.UserID, claims.Email, state.Secret, req) {
+		return
+	}
+
+	if err := utils.ClearLoginFailures(claims.Email); err != nil {
+		log.Printf("Failed to clear login failures for user %d: %v", claims.UserID, err)
+	}
+	if err := utils.RevokeToken(claims.Id, time.Unix(claims.ExpiresAt, 0)); err != nil {
+		http.Error(w, "Error completing login", http.StatusInternalServerError)
+		return
+	}
+
+	session, err := utils.IssueSession(claims.UserID, claims.Email)
+	if err != nil {
+		http.Error(w, "Error generating token", http.StatusInternalServerError)
+		return
+	}
+
+	setSessionCookies(w, session)
+	fmt.Fprintln(w, "Login successful")
+}
+
+func EnrollTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+
+	secret, err := utils.GenerateTOTPSecret()
+	if err != nil {
+		http.Error(w, "Error generating secret", http.StatusInternalServerError)
+		return
+	}
+
+	err = models.SetPendingTOTPSecret(principal.UserID, secret)
+	if errors.Is(err, models.ErrMFAAlreadyEnabled) {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Error saving secret: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"secret":      secret,
+		"otpauth_uri": utils.TOTPURI(mfaIssuer, principal.Email, secret),
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func ConfirmTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	userID := principal.UserID
+
+	var req mfaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	state, err := models.GetTOTPState(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if state.Enabled {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	}
+	if state.Secret == "" {
+		http.Error(w, "Start two-factor enrolment first", http.StatusBadRequest)
+		return
+	}
+
+	if !checkSecondFactor(w, r, userID, principal.Email, state.Secret, mfaRequest{Code: req.Code}) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	err = models.EnableTOTP(userID, hashes)
+	if errors.Is(err, models.ErrMFAAlreadyEnabled) {
+		http.Error(w, "Two-factor authentication is already enabled", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Error enabling two-factor authentication: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"recovery_codes": codes,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func DisableTOTPHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	userID := principal.UserID
+
+	var req mfaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	state, err := models.GetTOTPState(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !state.Enabled {
+		http.Error(w, models.ErrMFANotEnrolled.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !checkSecondFactor(w, r, userID, principal.Email, state.Secret, req) {
+		return
+	}
+
+	err = models.DisableTOTP(userID)
+	if err != nil {
+		http.Error(w, "Error disabling two-factor authentication: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Two-factor authentication disabled")
+}
+
+func RegenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	principal, ok := middleware.PrincipalFromContext(r.Context())
+	if !ok {
+		http.Error(w, "Authentication required", http.StatusUnauthorized)
+		return
+	}
+	userID := principal.UserID
+
+	var req mfaRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Code == "" {
+		http.Error(w, "A current authentication code is required", http.StatusBadRequest)
+		return
+	}
+
+	state, err := models.GetTOTPState(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving account: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !state.Enabled {
+		http.Error(w, models.ErrMFANotEnrolled.Error(), http.StatusBadRequest)
+		return
+	}
+
+	if !checkSecondFactor(w, r, userID, principal.Email, state.Secret, mfaRequest{Code: req.Code}) {
+		return
+	}
+
+	codes, hashes, err := newRecoveryCodes()
+	if err != nil {
+		http.Error(w, "Error generating recovery codes", http.StatusInternalServerError)
+		return
+	}
+
+	err = models.ReplaceRecoveryCodes(userID, hashes)
+	if err != nil {
+		http.Error(w, "Error saving recovery codes: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"recovery_codes": codes,
+	}
+	json.NewEncoder(w).Encode(response)
+}
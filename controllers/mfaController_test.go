@@ -0,0 +1,134 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/utils"
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func totpCode(t *testing.T, secret string, now time.Time) string {
+	key, err := base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(secret)
+	assert.NoError(t, err)
+
+	var counter [8]byte
+	binary.BigEndian.PutUint64(counter[:], uint64(now.Unix()/30))
+	mac := hmac.New(sha1.New, key)
+	mac.Write(counter[:])
+	sum := mac.Sum(nil)
+	offset := sum[len(sum)-1] & 0x0f
+	return fmt.Sprintf("%06d", (binary.BigEndian.Uint32(sum[offset:offset+4])&0x7fffffff)%1000000)
+}
+
+func TestLoginWithTOTP(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	previousRedis := config.RedisClient
+	config.RedisClient = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer func() { config.RedisClient = previousRedis }()
+
+	secret, err := utils.GenerateTOTPSecret()
+	assert.NoError(t, err)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	mock.ExpectQuery("SELECT id, email, password, (.+) FROM users").
+		WithArgs("test@example.com").
+		WillReturnRows(sqlmock.NewRows([]string{"id", "email", "password", "mfa_enabled"}).
+			AddRow(1, "test@example.com", string(hashedPassword), true))
+
+	req := httptest.NewRequest(http.MethodPost, "/login", strings.NewReader(`{"email":"test@example.com","password":"password"}`))
+	rr := httptest.NewRecorder()
+	LoginHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Empty(t, rr.Result().Cookies())
+	var challenge struct {
+		MFARequired bool   `json:"mfa_required"`
+		MFAToken    string `json:"mfa_token"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&challenge))
+	assert.True(t, challenge.MFARequired)
+
+	code := totpCode(t, secret, time.Now())
+	mock.ExpectQuery("SELECT totp_secret").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "enabled"}).AddRow(secret, true))
+	mock.ExpectExec("UPDATE users SET totp_last_step").
+		WithArgs(time.Now().Unix()/30, 1).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	body := `{"mfa_token":"` + challenge.MFAToken + `","code":"` + code + `"}`
+	req = httptest.NewRequest(http.MethodPost, "/login/mfa", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	LoginMFAHandler(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Len(t, rr.Result().Cookies(), 2)
+
+	// The challenge is single use.
+	req = httptest.NewRequest(http.MethodPost, "/login/mfa", strings.NewReader(body))
+	rr = httptest.NewRecorder()
+	LoginMFAHandler(rr, req)
+
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDisableTOTPIsThrottled(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	previousRedis := config.RedisClient
+	config.RedisClient = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer func() { config.RedisClient = previousRedis }()
+
+	secret, err := utils.GenerateTOTPSecret()
+	assert.NoError(t, err)
+	wrongCode := totpCode(t, secret, time.Now().Add(time.Hour))
+
+	// A stolen access token must not allow guessing the code to turn MFA off.
+	for _, want := range []int{http.StatusUnauthorized, http.StatusUnauthorized, http.StatusUnauthorized, http.StatusTooManyRequests} {
+		mock.ExpectQuery("SELECT totp_secret").
+			WithArgs(1).
+			WillReturnRows(sqlmock.NewRows([]string{"totp_secret", "enabled"}).AddRow(secret, true))
+
+		req := httptest.NewRequest(http.MethodDelete, "/me/mfa/totp", strings.NewReader(`{"code":"`+wrongCode+`"}`))
+		req = withPrincipal(req, 1)
+		rr := httptest.NewRecorder()
+		DisableTOTPHandler(rr, req)
+
+		assert.Equal(t, want, rr.Code)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,151 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/models"
+	"authentication/utils"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// checkMIMEPolicy rejects content whose sniffed type the admin-configured
+// rules do not allow.
+func checkMIMEPolicy(w http.ResponseWriter, mimeType string) bool {
+	rules, err := models.GetMIMERules()
+	if err != nil {
+		http.Error(w, "Error retrieving file type policy: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if !models.MIMETypeAllowed(rules, mimeType) {
+		http.Error(w, fmt.Sprintf("File type %s is not allowed", mimeType), http.StatusUnsupportedMediaType)
+		return false
+	}
+	return true
+}
+
+// sniffStoredObject detects the type of content that reached storage
+// without passing through the server in one piece.
+func sniffStoredObject(ctx context.Context, objectKey string) (string, error) {
+	body, err := config.Storage.GetRange(ctx, objectKey, 0, utils.SniffLength)
+	if err != nil {
+		return "", err
+	}
+	defer body.Close()
+
+	head, err := io.ReadAll(io.LimitReader(body, utils.SniffLength))
+	if err != nil {
+		return "", err
+	}
+	return utils.DetectMIMEType(head), nil
+}
+
+// storeSniffedType replaces the Content-Type the client declared for content
+// that reached storage directly, since storage services serve objects with
+// the type they were stored with.
+func storeSniffedType(ctx context.Context, objectKey, mimeType string) error {
+	return config.Storage.Copy(ctx, objectKey, objectKey, mimeType)
+}
+
+func validMIMEPattern(pattern string) bool {
+	if pattern == "*/*" {
+		return true
+	}
+	family, subtype, ok := strings.Cut(pattern, "/")
+	if !ok || family == "*" {
+		return false
+	}
+	if subtype == "*" {
+		subtype = "any"
+	}
+	_, params, err := mime.ParseMediaType(family + "/" + subtype)
+	return err == nil && len(params) == 0
+}
+
+func ListMIMERulesHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	rules, err := models.GetMIMERules()
+	if err != nil {
+		http.Error(w, "Error retrieving MIME rules: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(rules)
+}
+
+// SaveMIMERuleHandler adds an allow or deny rule, replacing the action of
+// any existing rule for the same pattern.
+func SaveMIMERuleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var req struct {
+		Pattern string `json:"pattern"`
+		Action  string `json:"action"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+
+	pattern := strings.ToLower(strings.TrimSpace(req.Pattern))
+	if !validMIMEPattern(pattern) {
+		http.Error(w, "pattern must be a MIME type such as application/pdf, image/* or */*", http.StatusBadRequest)
+		return
+	}
+	if req.Action != models.MIMEActionAllow && req.Action != models.MIMEActionDeny {
+		http.Error(w, "action must be allow or deny", http.StatusBadRequest)
+		return
+	}
+
+	rule, err := models.SaveMIMERule(pattern, req.Action)
+	if err != nil {
+		http.Error(w, "Error saving MIME rule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(rule)
+}
+
+func DeleteMIMERuleHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+		return
+	}
+
+	err = models.DeleteMIMERule(id)
+	if errors.Is(err, models.ErrMIMERuleNotFound) {
+		http.Error(w, "MIME rule not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error deleting MIME rule: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "MIME rule deleted successfully")
+}
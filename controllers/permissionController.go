@@ -0,0 +1,203 @@
+package controllers
+
+import (
+	"authentication/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+func authorizeFile(w http.ResponseWriter, fileID, userID int, required models.Permission) (*models.FileMetadata, bool) {
+	file, _, err := models.GetFileForUser(fileID, userID, required)
+	if errors.Is(err, models.ErrForbidden) {
+		http.Error(w, "You do not have permission to perform this action on the file", http.StatusForbidden)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return nil, false
+	}
+	return file, true
+}
+
+// requireCleanScan keeps content that has not passed the malware scan from
+// being downloaded or shared.
+func requireCleanScan(w http.ResponseWriter, scanStatus string) bool {
+	switch scanStatus {
+	case models.ScanStatusClean:
+		return true
+	case models.ScanStatusInfected:
+		http.Error(w, "File has been quarantined because malware was detected", http.StatusForbidden)
+	default:
+		http.Error(w, "File is still being scanned for malware; try again shortly", http.StatusConflict)
+	}
+	return false
+}
+
+func GrantFileAccessHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	email := strings.TrimSpace(r.URL.Query().Get("email"))
+	permission := models.Permission(r.URL.Query().Get("permission"))
+	if email == "" || !permission.Valid() {
+		http.Error(w, "Invalid email or permission (expected read or write)", http.StatusBadRequest)
+		return
+	}
+
+	file, ok := authorizeFile(w, fileID, userID, models.PermissionOwner)
+	if !ok {
+		return
+	}
+	if !requireCleanScan(w, file.ScanStatus) {
+		return
+	}
+
+	if !models.UserExists(email) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	granteeID, err := models.GetUserIDByEmail(email)
+	if err != nil {
+		http.Error(w, "Error retrieving user: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if granteeID == userID {
+		http.Error(w, "You already own this file", http.StatusBadRequest)
+		return
+	}
+
+	err = models.GrantFileAccess(fileID, granteeID, userID, permission)
+	if err != nil {
+		http.Error(w, "Error granting access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"file_id":    fileID,
+		"user_id":    granteeID,
+		"email":      email,
+		"permission": permission,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func ListFileGrantsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := authorizeFile(w, fileID, userID, models.PermissionOwner); !ok {
+		return
+	}
+
+	grants, err := models.GetFileGrants(fileID)
+	if err != nil {
+		http.Error(w, "Error retrieving permissions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"permissions": grants,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func RevokeFileAccessHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	granteeID, err := strconv.Atoi(mux.Vars(r)["user_id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := authorizeFile(w, fileID, userID, models.PermissionOwner); !ok {
+		return
+	}
+
+	err = models.RevokeFileAccess(fileID, granteeID)
+	if errors.Is(err, models.ErrFileNotFound) {
+		http.Error(w, "Permission not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error revoking access: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Access revoked successfully")
+}
+
+func SharedWithMeHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := models.GetFilesSharedWithUser(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving shared files: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"files": files,
+	}
+	json.NewEncoder(w).Encode(response)
+}
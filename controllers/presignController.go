@@ -0,0 +1,418 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/models"
+	"authentication/storage"
+	"authentication/utils"
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+func presignStorage(w http.ResponseWriter) (storage.Presigner, bool) {
+	presigner, ok := config.Storage.(storage.Presigner)
+	if !ok {
+		http.Error(w, "Presigned URLs are not supported by the storage backend", http.StatusNotImplemented)
+	}
+	return presigner, ok
+}
+
+// CreatePresignedUploadHandler hands out a URL the client PUTs the file to
+// directly. The file only appears once the client calls the complete
+// endpoint; uploads that are never completed are discarded after
+// config.ResumableUploadTTL.
+func CreatePresignedUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requireVerifiedEmail(w, userID) {
+		return
+	}
+
+	presigner, ok := presignStorage(w)
+	if !ok {
+		return
+	}
+
+	var req struct {
+		FileName    string `json:"file_name"`
+		FileSize    int64  `json:"file_size"`
+		ContentType string `json:"content_type"`
+		FolderID    *int   `json:"folder_id"`
+		FileID      *int   `json:"file_id"`
+		Retention   string `json:"retention"`
+		ExpiresAt   string `json:"expires_at"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request payload", http.StatusBadRequest)
+		return
+	}
+	if req.FileName == "" {
+		http.Error(w, "Missing file_name", http.StatusBadRequest)
+		return
+	}
+	if req.FileSize <= 0 {
+		http.Error(w, "file_size must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	if req.FileSize > config.MaxUploadBytes {
+		http.Error(w, fmt.Sprintf("Upload exceeds the maximum size of %d bytes", config.MaxUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	fields := map[string]string{"retention": req.Retention, "expires_at": req.ExpiresAt}
+	if req.FolderID != nil {
+		fields["folder_id"] = strconv.Itoa(*req.FolderID)
+	}
+	if req.FileID != nil {
+		fields["file_id"] = strconv.Itoa(*req.FileID)
+	}
+	opts, ok := resolveUploadOptions(w, userID, fields)
+	if !ok {
+		return
+	}
+	if req.FileSize > opts.remaining {
+		http.Error(w, fmt.Sprintf("Storage quota exceeded: %d bytes requested but only %d available", req.FileSize, opts.remaining), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	objectKey, err := storage.NewObjectKey(userID, req.FileName)
+	if err != nil {
+		http.Error(w, "Error generating object key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		http.Error(w, "Error generating upload ID", http.StatusInternalServerError)
+		return
+	}
+
+	uploadURL, err := presigner.PresignPut(r.Context(), objectKey, req.ContentType, req.FileSize, config.PresignedURLTTL)
+	if err != nil {
+		http.Error(w, "Error presigning upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	// The upload must not be reaped while its URL can still write to storage.
+	expiresAt := time.Now().Add(config.ResumableUploadTTL)
+	if urlExpiry := time.Now().Add(config.PresignedURLTTL); urlExpiry.After(expiresAt) {
+		expiresAt = urlExpiry
+	}
+
+	err = models.CreatePendingUpload(&models.PendingUpload{
+		ID:          id,
+		UserID:      userID,
+		FileID:      opts.existingFileID,
+		FolderID:    opts.folderID,
+		FileName:    req.FileName,
+		ContentType: req.ContentType,
+		ExpiryDate:  opts.expiryDate,
+		ObjectKey:   objectKey,
+		FileSize:    req.FileSize,
+		ExpiresAt:   expiresAt,
+	})
+	if err != nil {
+		http.Error(w, "Error saving upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	headers := map[string]string{}
+	if req.ContentType != "" {
+		headers["Content-Type"] = req.ContentType
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	response := map[string]interface{}{
+		"upload_id":    id,
+		"upload_url":   uploadURL,
+		"method":       http.MethodPut,
+		"headers":      headers,
+		"expires_at":   time.Now().Add(config.PresignedURLTTL),
+		"complete_url": config.BaseURL + "/uploads/" + id + "/complete",
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// hashStoredObject reads an object back from storage, since content written
+// through a presigned URL never passes through the server. The same pass
+// returns the start of the content for type detection.
+func hashStoredObject(ctx context.Context, objectKey string) (*contentDigest, []byte, int64, error) {
+	body, _, err := config.Storage.Get(ctx, objectKey)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	defer body.Close()
+
+	content := bufio.NewReaderSize(body, utils.SniffLength)
+	head, err := content.Peek(utils.SniffLength)
+	if err != nil && err != io.EOF {
+		return nil, nil, 0, err
+	}
+	head = append([]byte(nil), head...)
+
+	digest := newContentDigest()
+	size, err := io.Copy(digest, content)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return digest, head, size, nil
+}
+
+// moveStagedObject moves a presigned upload to a newly generated key. The
+// staged object is deleted whether or not the move succeeds.
+func moveStagedObject(ctx context.Context, userID int, upload *models.PendingUpload) (string, error) {
+	defer config.Storage.Delete(ctx, upload.ObjectKey)
+
+	objectKey, err := storage.NewObjectKey(userID, upload.FileName)
+	if err != nil {
+		return "", err
+	}
+	if err := config.Storage.Copy(ctx, upload.ObjectKey, objectKey, ""); err != nil {
+		return "", err
+	}
+	return objectKey, nil
+}
+
+// CompletePresignedUploadHandler records a file uploaded through a presigned
+// URL. The object is moved to a key the client was never given a URL for,
+// so the signed PUT cannot replace it afterwards. Content-MD5 and X-Checksum-SHA256 headers on this request are checked
+// against the stored object, and its sniffed type against the MIME policy.
+func CompletePresignedUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	expected, err := parseChecksums(r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	upload, err := models.GetPendingUpload(mux.Vars(r)["id"], userID)
+	if errors.Is(err, models.ErrUploadSessionNotFound) {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error retrieving upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// Until the object exists the client may still retry the PUT, so the
+	// pending upload is kept.
+	info, err := config.Storage.Stat(r.Context(), upload.ObjectKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		http.Error(w, "File has not been uploaded yet", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Error reading file from storage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// A presigned URL cannot be revoked, so the upload is only marked
+	// completed and reaped once its URL has expired, along with anything
+	// PUT to the staged key in the meantime.
+	err = models.CompletePendingUpload(upload.ID)
+	if errors.Is(err, models.ErrUploadSessionNotFound) {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error completing upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	objectKey := upload.ObjectKey
+	discard := func() {
+		config.Storage.Delete(r.Context(), objectKey)
+	}
+
+	if info.Size != upload.FileSize {
+		discard()
+		http.Error(w, fmt.Sprintf("Uploaded file is %d bytes but %d were declared", info.Size, upload.FileSize), http.StatusBadRequest)
+		return
+	}
+
+	opts := &uploadOptions{
+		userID:         userID,
+		ownerID:        userID,
+		folderID:       upload.FolderID,
+		existingFileID: upload.FileID,
+		expiryDate:     upload.ExpiryDate,
+	}
+	if upload.FileID != nil {
+		existing, ok := authorizeFile(w, *upload.FileID, userID, models.PermissionWrite)
+		if !ok {
+			discard()
+			return
+		}
+		opts.ownerID = existing.UserID
+	}
+	if !checkQuota(w, opts.ownerID, upload.FileSize) {
+		discard()
+		return
+	}
+
+	objectKey, err = moveStagedObject(r.Context(), opts.ownerID, upload)
+	if err != nil {
+		http.Error(w, "Error storing file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	digest, head, size, err := hashStoredObject(r.Context(), objectKey)
+	if err != nil {
+		discard()
+		http.Error(w, "Error reading file from storage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if size != upload.FileSize {
+		discard()
+		http.Error(w, fmt.Sprintf("Uploaded file is %d bytes but %d were declared", size, upload.FileSize), http.StatusBadRequest)
+		return
+	}
+	if err := expected.verify(digest); err != nil {
+		discard()
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	mimeType := utils.DetectMIMEType(head)
+	if !checkMIMEPolicy(w, mimeType) {
+		discard()
+		return
+	}
+	if err := storeSniffedType(r.Context(), objectKey, mimeType); err != nil {
+		discard()
+		http.Error(w, "Error storing file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	result, ok := recordUpload(w, r, opts, objectKey, upload.FileName, mimeType, size, digest.SHA256())
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+func PresignedDownloadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file_id", http.StatusBadRequest)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	file, ok := authorizeFile(w, fileID, userID, models.PermissionRead)
+	if !ok {
+		return
+	}
+	if !requireCleanScan(w, file.ScanStatus) {
+		return
+	}
+
+	presigner, ok := presignStorage(w)
+	if !ok {
+		return
+	}
+
+	downloadURL, err := presigner.PresignGet(r.Context(), file.ObjectKey, file.FileName, file.MimeType, config.PresignedURLTTL)
+	if err != nil {
+		http.Error(w, "Error presigning download: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"url":        downloadURL,
+		"expires_at": time.Now().Add(config.PresignedURLTTL),
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// LocalStorageHandler serves the signed URLs issued by the local backend in
+// place of a storage service's presigned URLs. The signature is the only
+// authorization.
+func LocalStorageHandler(w http.ResponseWriter, r *http.Request) {
+	local, ok := config.Storage.(*storage.LocalBackend)
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != http.MethodGet && r.Method != http.MethodHead && r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	key := mux.Vars(r)["key"]
+	signed, err := local.VerifySignedURL(r.Method, key, r.URL.Query())
+	if err != nil {
+		http.Error(w, "Invalid or expired signature", http.StatusForbidden)
+		return
+	}
+
+	if r.Method != http.MethodPut {
+		serveStoredObject(w, r, signed.FileName, filepath.Ext(signed.FileName), signed.ContentType, key, "", time.Time{})
+		return
+	}
+
+	// The signature outlives the upload it was issued for, so writes are only
+	// accepted while the upload is pending.
+	pending, err := models.PendingUploadExists(key)
+	if err != nil {
+		http.Error(w, "Error retrieving upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	} else if !pending {
+		http.Error(w, "Upload is no longer pending", http.StatusForbidden)
+		return
+	}
+
+	if r.ContentLength != signed.Size {
+		http.Error(w, fmt.Sprintf("Content-Length must be %d", signed.Size), http.StatusBadRequest)
+		return
+	}
+	if signed.ContentType != "" && r.Header.Get("Content-Type") != signed.ContentType {
+		http.Error(w, "Content-Type does not match the signed URL", http.StatusForbidden)
+		return
+	}
+
+	err = local.Put(r.Context(), key, http.MaxBytesReader(w, r.Body, signed.Size), signed.ContentType)
+	if err != nil {
+		writeUploadReadError(w, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
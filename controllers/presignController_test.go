@@ -0,0 +1,228 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/storage"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func newSignedLocalBackend(t *testing.T) *storage.LocalBackend {
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	backend.EnableSignedURLs("http://localhost:8080/storage/local", []byte("test-key"))
+	return backend
+}
+
+func pendingUploadRow(id, objectKey string, size int64) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "file_id", "folder_id", "file_name", "content_type", "expiry_date", "object_key", "file_size", "created_at", "expires_at"}).
+		AddRow(id, 1, nil, nil, "testfile.txt", "text/plain", nil, objectKey, size, time.Now(), time.Now().Add(time.Hour))
+}
+
+func expectCompletePendingUpload(mock sqlmock.Sqlmock, id string) {
+	mock.ExpectExec("UPDATE pending_uploads SET completed_at").
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+}
+
+func expectPendingUploadExists(mock sqlmock.Sqlmock, objectKey interface{}, exists bool) {
+	mock.ExpectQuery("SELECT EXISTS(.+)FROM pending_uploads").
+		WithArgs(objectKey).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(exists))
+}
+
+// localStorageRequest turns a signed URL into a request for LocalStorageHandler.
+func localStorageRequest(t *testing.T, method, signedURL string, body io.Reader) *http.Request {
+	parsed, err := url.Parse(signedURL)
+	if err != nil {
+		t.Fatalf("invalid signed URL: %v", err)
+	}
+	req := httptest.NewRequest(method, parsed.RequestURI(), body)
+	return mux.SetURLVars(req, map[string]string{"key": strings.TrimPrefix(parsed.Path, "/storage/local/")})
+}
+
+func TestPresignedUploadFlow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend := newSignedLocalBackend(t)
+	config.Storage = backend
+
+	expectVerifiedEmail(mock, 1, true)
+	mock.ExpectQuery("SELECT default_retention_seconds FROM users").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"default_retention_seconds"}).AddRow(nil))
+	expectStorageUsage(mock, 1, 100, 0)
+	objectKey := &capture{}
+	mock.ExpectExec("INSERT INTO pending_uploads").
+		WithArgs(sqlmock.AnyArg(), 1, nil, nil, "testfile.txt", "text/plain", sqlmock.AnyArg(), objectKey, 11, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/uploads/presigned", strings.NewReader(`{"file_name":"testfile.txt","file_size":11,"content_type":"text/plain"}`))
+	req = withPrincipal(req, 1)
+	rr := httptest.NewRecorder()
+
+	CreatePresignedUploadHandler(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var presigned struct {
+		UploadID  string            `json:"upload_id"`
+		UploadURL string            `json:"upload_url"`
+		Headers   map[string]string `json:"headers"`
+	}
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&presigned))
+	assert.Equal(t, "text/plain", presigned.Headers["Content-Type"])
+
+	// Completing before the PUT leaves the pending upload in place.
+	mock.ExpectQuery("SELECT (.+) FROM pending_uploads").
+		WithArgs(presigned.UploadID, 1).
+		WillReturnRows(pendingUploadRow(presigned.UploadID, objectKey.value.(string), 11))
+
+	complete := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/uploads/"+presigned.UploadID+"/complete", nil), map[string]string{"id": presigned.UploadID})
+	complete = withPrincipal(complete, 1)
+	rr = httptest.NewRecorder()
+	CompletePresignedUploadHandler(rr, complete)
+	assert.Equal(t, http.StatusConflict, rr.Code)
+
+	expectPendingUploadExists(mock, objectKey.value, true)
+	put := localStorageRequest(t, http.MethodPut, presigned.UploadURL, strings.NewReader("hello world"))
+	put.Header.Set("Content-Type", "text/plain")
+	rr = httptest.NewRecorder()
+	LocalStorageHandler(rr, put)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	mock.ExpectQuery("SELECT (.+) FROM pending_uploads").
+		WithArgs(presigned.UploadID, 1).
+		WillReturnRows(pendingUploadRow(presigned.UploadID, objectKey.value.(string), 11))
+	expectCompletePendingUpload(mock, presigned.UploadID)
+	expectStorageUsage(mock, 1, 100, 0)
+	expectMIMERules(mock)
+	storedKey := &capture{}
+	mock.ExpectQuery("INSERT INTO blobs").
+		WithArgs(storedKey, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"object_key"}).AddRow("1/stored.txt"))
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO files").
+		WithArgs(1, nil, "testfile.txt", 11, sqlmock.AnyArg(), sqlmock.AnyArg(), ".txt", "text/plain", "pending", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO file_versions").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "text/plain", "pending").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+
+	rr = httptest.NewRecorder()
+	CompletePresignedUploadHandler(rr, complete)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	// The file lives under a new key, so the signed PUT URL cannot replace it.
+	assert.NotEqual(t, objectKey.value, storedKey.value)
+	_, err = backend.Stat(context.Background(), objectKey.value.(string))
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	expectPendingUploadExists(mock, objectKey.value, false)
+	put = localStorageRequest(t, http.MethodPut, presigned.UploadURL, strings.NewReader("HELLO WORLD"))
+	put.Header.Set("Content-Type", "text/plain")
+	rr = httptest.NewRecorder()
+	LocalStorageHandler(rr, put)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	_, err = backend.Stat(context.Background(), objectKey.value.(string))
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCompletePresignedUploadRejectsSizeMismatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend := newSignedLocalBackend(t)
+	config.Storage = backend
+	assert.NoError(t, backend.Put(context.Background(), "1/object.txt", strings.NewReader("hello"), "text/plain"))
+
+	mock.ExpectQuery("SELECT (.+) FROM pending_uploads").
+		WithArgs("abc", 1).
+		WillReturnRows(pendingUploadRow("abc", "1/object.txt", 11))
+	expectCompletePendingUpload(mock, "abc")
+
+	req := mux.SetURLVars(httptest.NewRequest(http.MethodPost, "/uploads/abc/complete", nil), map[string]string{"id": "abc"})
+	req = withPrincipal(req, 1)
+	rr := httptest.NewRecorder()
+
+	CompletePresignedUploadHandler(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	_, err = backend.Stat(context.Background(), "1/object.txt")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestLocalStorageHandler(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend := newSignedLocalBackend(t)
+	config.Storage = backend
+	assert.NoError(t, backend.Put(context.Background(), "1/object.txt", strings.NewReader("hello world"), "text/plain"))
+
+	getURL, err := backend.PresignGet(context.Background(), "1/object.txt", "report.html", "text/plain", time.Minute)
+	assert.NoError(t, err)
+
+	rr := httptest.NewRecorder()
+	LocalStorageHandler(rr, localStorageRequest(t, http.MethodGet, getURL, nil))
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "hello world", rr.Body.String())
+	assert.Equal(t, "text/plain", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "report.html")
+
+	rr = httptest.NewRecorder()
+	LocalStorageHandler(rr, localStorageRequest(t, http.MethodGet, getURL+"x", nil))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	putURL, err := backend.PresignPut(context.Background(), "1/upload.txt", "", 5, time.Minute)
+	assert.NoError(t, err)
+	expectPendingUploadExists(mock, "1/upload.txt", false)
+	rr = httptest.NewRecorder()
+	LocalStorageHandler(rr, localStorageRequest(t, http.MethodPut, putURL, strings.NewReader("hello")))
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+
+	expectPendingUploadExists(mock, "1/upload.txt", true)
+	rr = httptest.NewRecorder()
+	LocalStorageHandler(rr, localStorageRequest(t, http.MethodPut, putURL, strings.NewReader("too long")))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	_, err = backend.Stat(context.Background(), "1/upload.txt")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,99 @@
+package controllers
+
+import (
+	"authentication/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+// checkQuota rejects a request that would take the user's stored bytes past
+// their quota. additional may be negative when a file shrinks.
+func checkQuota(w http.ResponseWriter, userID int, additional int64) bool {
+	usage, err := models.GetStorageUsage(userID)
+	if err != nil {
+		http.Error(w, "Error checking storage quota: "+err.Error(), http.StatusInternalServerError)
+		return false
+	}
+	if additional > 0 && usage.UsedBytes+additional > usage.QuotaBytes {
+		http.Error(w, fmt.Sprintf("Storage quota exceeded: %d more bytes would bring usage to %d of %d bytes",
+			additional, usage.UsedBytes+additional, usage.QuotaBytes), http.StatusRequestEntityTooLarge)
+		return false
+	}
+	return true
+}
+
+func StorageUsageHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	usage, err := models.GetStorageUsage(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving storage usage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usage.ByExtension, err = models.GetUsageByExtension(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving storage usage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(usage)
+}
+
+func SetUserQuotaHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return
+	}
+
+	var quota sql.NullInt64
+	if value := r.URL.Query().Get("quota_bytes"); value != "default" {
+		quota.Int64, err = strconv.ParseInt(value, 10, 64)
+		if err != nil || quota.Int64 < 0 {
+			http.Error(w, "quota_bytes must be a non-negative integer or \"default\"", http.StatusBadRequest)
+			return
+		}
+		quota.Valid = true
+	}
+
+	err = models.SetUserQuota(userID, quota)
+	if errors.Is(err, models.ErrUserNotFound) {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error saving quota: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	usage, err := models.GetStorageUsage(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving storage usage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(usage)
+}
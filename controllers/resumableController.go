@@ -0,0 +1,426 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/models"
+	"authentication/storage"
+	"authentication/utils"
+	"crypto/sha256"
+	"encoding"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Resumable uploads follow the core tus 1.0.0 protocol: POST creates a
+// session, HEAD reports the offset to resume from and PATCH appends a chunk.
+// Each PATCH is stored as one multipart part, so an interrupted chunk is
+// discarded and resent from the last reported offset.
+const (
+	tusVersion             = "1.0.0"
+	tusChunkContentType    = "application/offset+octet-stream"
+	maxResumableChunkBytes = 128 << 20
+)
+
+// parseUploadMetadata decodes a tus Upload-Metadata header: comma separated
+// pairs of a key and a base64 encoded value.
+func parseUploadMetadata(header string) (map[string]string, error) {
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(header, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		key, encoded, _ := strings.Cut(pair, " ")
+		value, err := base64.StdEncoding.DecodeString(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("invalid Upload-Metadata value for %s", key)
+		}
+		metadata[key] = string(value)
+	}
+	return metadata, nil
+}
+
+func multipartStorage(w http.ResponseWriter) (storage.MultipartBackend, bool) {
+	backend, ok := config.Storage.(storage.MultipartBackend)
+	if !ok {
+		http.Error(w, "Resumable uploads are not supported by the storage backend", http.StatusNotImplemented)
+	}
+	return backend, ok
+}
+
+func loadUploadSession(w http.ResponseWriter, r *http.Request) (*models.UploadSession, bool) {
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return nil, false
+	}
+
+	session, err := models.GetUploadSession(mux.Vars(r)["id"], userID)
+	if errors.Is(err, models.ErrUploadSessionNotFound) {
+		http.Error(w, "Upload not found", http.StatusNotFound)
+		return nil, false
+	} else if err != nil {
+		http.Error(w, "Error retrieving upload: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	return session, true
+}
+
+func restoreHash(state []byte) (hash.Hash, error) {
+	hasher := sha256.New()
+	if err := hasher.(encoding.BinaryUnmarshaler).UnmarshalBinary(state); err != nil {
+		return nil, err
+	}
+	return hasher, nil
+}
+
+func CreateResumableUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+	if !requireVerifiedEmail(w, userID) {
+		return
+	}
+
+	backend, ok := multipartStorage(w)
+	if !ok {
+		return
+	}
+
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length <= 0 {
+		http.Error(w, "Upload-Length must be a positive integer", http.StatusBadRequest)
+		return
+	}
+	if length > config.MaxUploadBytes {
+		http.Error(w, fmt.Sprintf("Upload exceeds the maximum size of %d bytes", config.MaxUploadBytes), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	metadata, err := parseUploadMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	fileName := metadata["filename"]
+	if fileName == "" {
+		http.Error(w, "Upload-Metadata must include a filename", http.StatusBadRequest)
+		return
+	}
+
+	opts, ok := resolveUploadOptions(w, userID, metadata)
+	if !ok {
+		return
+	}
+	if length > opts.remaining {
+		http.Error(w, fmt.Sprintf("Storage quota exceeded: %d bytes requested but only %d available", length, opts.remaining), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	objectKey, err := storage.NewObjectKey(userID, fileName)
+	if err != nil {
+		http.Error(w, "Error generating object key: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	id, err := utils.GenerateSecureToken(16)
+	if err != nil {
+		http.Error(w, "Error generating upload ID", http.StatusInternalServerError)
+		return
+	}
+
+	hashState, err := sha256.New().(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		http.Error(w, "Error initialising checksum", http.StatusInternalServerError)
+		return
+	}
+
+	storageUploadID, err := backend.CreateMultipart(r.Context(), objectKey, metadata["content_type"])
+	if err != nil {
+		http.Error(w, "Error starting upload in storage: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = models.CreateUploadSession(&models.UploadSession{
+		ID:              id,
+		UserID:          userID,
+		FileID:          opts.existingFileID,
+		FolderID:        opts.folderID,
+		FileName:        fileName,
+		ContentType:     metadata["content_type"],
+		ExpiryDate:      opts.expiryDate,
+		ObjectKey:       objectKey,
+		StorageUploadID: storageUploadID,
+		Length:          length,
+		SHA256State:     hashState,
+		ExpiresAt:       time.Now().Add(config.ResumableUploadTTL),
+	})
+	if err != nil {
+		backend.AbortMultipart(r.Context(), objectKey, storageUploadID)
+		http.Error(w, "Error saving upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Location", config.BaseURL+"/uploads/resumable/"+id)
+	w.Header().Set("Upload-Offset", "0")
+	w.WriteHeader(http.StatusCreated)
+}
+
+func ResumableUploadOffsetHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodHead {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	session, ok := loadUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+	w.Header().Set("Upload-Length", strconv.FormatInt(session.Length, 10))
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(http.StatusOK)
+}
+
+func PatchResumableUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	if r.Header.Get("Content-Type") != tusChunkContentType {
+		http.Error(w, "Content-Type must be "+tusChunkContentType, http.StatusUnsupportedMediaType)
+		return
+	}
+
+	// Checksum headers on a PATCH describe that chunk, not the whole file.
+	expected, err := parseChecksums(r.Header)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	session, ok := loadUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil {
+		http.Error(w, "Upload-Offset must be an integer", http.StatusBadRequest)
+		return
+	}
+	if offset != session.Offset {
+		w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset, 10))
+		http.Error(w, "Upload-Offset does not match the current offset", http.StatusConflict)
+		return
+	}
+
+	backend, ok := multipartStorage(w)
+	if !ok {
+		return
+	}
+
+	hasher, err := restoreHash(session.SHA256State)
+	if err != nil {
+		http.Error(w, "Error restoring checksum: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	limit := session.Length - session.Offset
+	if limit > maxResumableChunkBytes {
+		limit = maxResumableChunkBytes
+	}
+
+	// Parts need a known length and a seekable body, so each chunk is spooled
+	// to disk before it is handed to the backend.
+	chunk, err := os.CreateTemp("", "resumable-chunk-*")
+	if err != nil {
+		http.Error(w, "Error buffering chunk: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	defer os.Remove(chunk.Name())
+	defer chunk.Close()
+
+	chunkDigest := newContentDigest()
+	size, err := io.Copy(io.MultiWriter(chunk, hasher, chunkDigest), http.MaxBytesReader(w, r.Body, limit))
+	if err != nil {
+		writeUploadReadError(w, err)
+		return
+	}
+	if err := expected.verify(chunkDigest); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	final := session.Offset+size == session.Length
+	if size == 0 || (!final && size < backend.MinPartSize()) {
+		http.Error(w, fmt.Sprintf("Chunks must be at least %d bytes except the last", backend.MinPartSize()), http.StatusBadRequest)
+		return
+	}
+	if _, err := chunk.Seek(0, io.SeekStart); err != nil {
+		http.Error(w, "Error buffering chunk: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	// The first chunk holds at least the bytes needed to sniff the type, so
+	// disallowed files are turned away before the rest is sent.
+	if session.Offset == 0 {
+		head, err := io.ReadAll(io.LimitReader(chunk, utils.SniffLength))
+		if err != nil {
+			http.Error(w, "Error buffering chunk: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+		if !checkMIMEPolicy(w, utils.DetectMIMEType(head)) {
+			backend.AbortMultipart(r.Context(), session.ObjectKey, session.StorageUploadID)
+			models.DeleteUploadSession(session.ID)
+			return
+		}
+		if _, err := chunk.Seek(0, io.SeekStart); err != nil {
+			http.Error(w, "Error buffering chunk: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	number := len(session.Parts) + 1
+	etag, err := backend.UploadPart(r.Context(), session.ObjectKey, session.StorageUploadID, number, chunk, size)
+	if err != nil {
+		http.Error(w, "Error storing chunk: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	hashState, err := hasher.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		http.Error(w, "Error saving checksum: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	parts := append(session.Parts, storage.CompletedPart{Number: number, ETag: etag})
+	err = models.AdvanceUploadSession(session.ID, session.Offset, session.Offset+size, parts, hashState, time.Now().Add(config.ResumableUploadTTL))
+	if errors.Is(err, models.ErrUploadOffsetConflict) {
+		http.Error(w, "Upload-Offset does not match the current offset", http.StatusConflict)
+		return
+	} else if err != nil {
+		http.Error(w, "Error saving upload progress: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Upload-Offset", strconv.FormatInt(session.Offset+size, 10))
+	if !final {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	session.Parts = parts
+	result, ok := finalizeResumableUpload(w, r, backend, session, hex.EncodeToString(hasher.Sum(nil)))
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(result)
+}
+
+// finalizeResumableUpload assembles the parts and records the file. Any
+// failure discards the upload, since the parts cannot be reused afterwards.
+func finalizeResumableUpload(w http.ResponseWriter, r *http.Request, backend storage.MultipartBackend, session *models.UploadSession, contentSHA256 string) (*uploadResult, bool) {
+	defer models.DeleteUploadSession(session.ID)
+
+	opts := &uploadOptions{
+		userID:         session.UserID,
+		ownerID:        session.UserID,
+		folderID:       session.FolderID,
+		existingFileID: session.FileID,
+		expiryDate:     session.ExpiryDate,
+	}
+	if session.FileID != nil {
+		existing, ok := authorizeFile(w, *session.FileID, session.UserID, models.PermissionWrite)
+		if !ok {
+			backend.AbortMultipart(r.Context(), session.ObjectKey, session.StorageUploadID)
+			return nil, false
+		}
+		opts.ownerID = existing.UserID
+	}
+	// Sessions are only checked against the quota when they are created, so
+	// several running at once could together exceed it.
+	if !checkQuota(w, opts.ownerID, session.Length) {
+		backend.AbortMultipart(r.Context(), session.ObjectKey, session.StorageUploadID)
+		return nil, false
+	}
+
+	err := backend.CompleteMultipart(r.Context(), session.ObjectKey, session.StorageUploadID, session.Parts)
+	if err != nil {
+		backend.AbortMultipart(r.Context(), session.ObjectKey, session.StorageUploadID)
+		http.Error(w, "Error assembling upload: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	mimeType, err := sniffStoredObject(r.Context(), session.ObjectKey)
+	if err != nil {
+		config.Storage.Delete(r.Context(), session.ObjectKey)
+		http.Error(w, "Error reading file from storage: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+	if !checkMIMEPolicy(w, mimeType) {
+		config.Storage.Delete(r.Context(), session.ObjectKey)
+		return nil, false
+	}
+	if err := storeSniffedType(r.Context(), session.ObjectKey, mimeType); err != nil {
+		config.Storage.Delete(r.Context(), session.ObjectKey)
+		http.Error(w, "Error storing file: "+err.Error(), http.StatusInternalServerError)
+		return nil, false
+	}
+
+	return recordUpload(w, r, opts, session.ObjectKey, session.FileName, mimeType, session.Length, contentSHA256)
+}
+
+func DeleteResumableUploadHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+	w.Header().Set("Tus-Resumable", tusVersion)
+
+	session, ok := loadUploadSession(w, r)
+	if !ok {
+		return
+	}
+
+	if backend, ok := config.Storage.(storage.MultipartBackend); ok {
+		err := backend.AbortMultipart(r.Context(), session.ObjectKey, session.StorageUploadID)
+		if err != nil && !errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Error aborting upload: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	err := models.DeleteUploadSession(session.ID)
+	if err != nil {
+		http.Error(w, "Error deleting upload: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,198 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/storage"
+	"database/sql/driver"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+// capture is a sqlmock argument matcher that remembers the value it saw, so
+// later expectations can hand the same state back to the handler.
+type capture struct {
+	value driver.Value
+}
+
+func (c *capture) Match(v driver.Value) bool {
+	c.value = v
+	return true
+}
+
+type resumableSession struct {
+	id, objectKey, uploadID driver.Value
+}
+
+func (s resumableSession) row(offset int64, parts, state driver.Value) *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "user_id", "file_id", "folder_id", "file_name", "content_type", "expiry_date", "object_key",
+		"storage_upload_id", "upload_length", "upload_offset", "parts", "sha256_state", "created_at", "expires_at"}).
+		AddRow(s.id, 1, nil, nil, "testfile.txt", "text/plain", nil, s.objectKey,
+			s.uploadID, 11, offset, parts, state, time.Now(), time.Now().Add(time.Hour))
+}
+
+func newPatchRequest(id string, offset int, body string) *http.Request {
+	req := httptest.NewRequest(http.MethodPatch, "/uploads/resumable/"+id, strings.NewReader(body))
+	req.Header.Set("Content-Type", tusChunkContentType)
+	req.Header.Set("Upload-Offset", strconv.Itoa(offset))
+	req = mux.SetURLVars(req, map[string]string{"id": id})
+	return withPrincipal(req, 1)
+}
+
+func TestParseUploadMetadata(t *testing.T) {
+	header := "filename " + base64.StdEncoding.EncodeToString([]byte("report.pdf")) + ",is_confidential, folder_id " + base64.StdEncoding.EncodeToString([]byte("7"))
+
+	metadata, err := parseUploadMetadata(header)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]string{"filename": "report.pdf", "is_confidential": "", "folder_id": "7"}, metadata)
+
+	_, err = parseUploadMetadata("filename not-base64!")
+	assert.Error(t, err)
+}
+
+func TestResumableUploadFlow(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+
+	expectVerifiedEmail(mock, 1, true)
+	mock.ExpectQuery("SELECT default_retention_seconds FROM users").
+		WithArgs(1).
+		WillReturnRows(sqlmock.NewRows([]string{"default_retention_seconds"}).AddRow(nil))
+	expectStorageUsage(mock, 1, 100, 0)
+	objectKey, uploadID, state := &capture{}, &capture{}, &capture{}
+	mock.ExpectExec("INSERT INTO upload_sessions").
+		WithArgs(sqlmock.AnyArg(), 1, nil, nil, "testfile.txt", "text/plain", sqlmock.AnyArg(), objectKey, uploadID, 11, state, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	req := httptest.NewRequest(http.MethodPost, "/uploads/resumable", nil)
+	req.Header.Set("Upload-Length", "11")
+	req.Header.Set("Upload-Metadata", "filename "+base64.StdEncoding.EncodeToString([]byte("testfile.txt"))+
+		",content_type "+base64.StdEncoding.EncodeToString([]byte("text/plain")))
+	req = withPrincipal(req, 1)
+	rr := httptest.NewRecorder()
+
+	CreateResumableUploadHandler(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, tusVersion, rr.Header().Get("Tus-Resumable"))
+	assert.Equal(t, "0", rr.Header().Get("Upload-Offset"))
+	id := path.Base(rr.Header().Get("Location"))
+	session := resumableSession{id: id, objectKey: objectKey.value, uploadID: uploadID.value}
+
+	mock.ExpectQuery("SELECT (.+) FROM upload_sessions").
+		WithArgs(id, 1).
+		WillReturnRows(session.row(0, []byte("[]"), state.value))
+	expectMIMERules(mock)
+	parts, nextState := &capture{}, &capture{}
+	mock.ExpectExec("UPDATE upload_sessions").
+		WithArgs(id, 0, 6, parts, nextState, sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr = httptest.NewRecorder()
+	PatchResumableUploadHandler(rr, newPatchRequest(id, 0, "hello "))
+
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, "6", rr.Header().Get("Upload-Offset"))
+
+	mock.ExpectQuery("SELECT (.+) FROM upload_sessions").
+		WithArgs(id, 1).
+		WillReturnRows(session.row(6, parts.value, nextState.value))
+	mock.ExpectExec("UPDATE upload_sessions").
+		WithArgs(id, 6, 11, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	expectStorageUsage(mock, 1, 100, 0)
+	expectMIMERules(mock)
+	expectBlob(mock, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", objectKey.value)
+	mock.ExpectBegin()
+	mock.ExpectQuery("INSERT INTO files").
+		WithArgs(1, nil, "testfile.txt", 11, sqlmock.AnyArg(), objectKey.value, ".txt", "text/plain", "pending", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO file_versions").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "text/plain", "pending").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
+	mock.ExpectExec("DELETE FROM upload_sessions").
+		WithArgs(id).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+
+	rr = httptest.NewRecorder()
+	PatchResumableUploadHandler(rr, newPatchRequest(id, 6, "world"))
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var result uploadResult
+	assert.NoError(t, json.NewDecoder(rr.Body).Decode(&result))
+	assert.Equal(t, 1, result.FileID)
+	assert.Equal(t, int64(11), result.FileSize)
+
+	object, _, err := backend.Get(req.Context(), objectKey.value.(string))
+	if assert.NoError(t, err) {
+		defer object.Close()
+		content := make([]byte, 32)
+		n, _ := object.Read(content)
+		assert.Equal(t, "hello world", string(content[:n]))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPatchResumableUploadOffsetMismatch(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+
+	session := resumableSession{id: "abc", objectKey: "users/1/testfile.txt", uploadID: "0123456789abcdef"}
+	mock.ExpectQuery("SELECT (.+) FROM upload_sessions").
+		WithArgs("abc", 1).
+		WillReturnRows(session.row(6, []byte(`[{"Number":1,"ETag":"x"}]`), []byte{}))
+
+	rr := httptest.NewRecorder()
+	PatchResumableUploadHandler(rr, newPatchRequest("abc", 0, "hello "))
+
+	assert.Equal(t, http.StatusConflict, rr.Code)
+	assert.Equal(t, "6", rr.Header().Get("Upload-Offset"))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestPatchResumableUploadRequiresOffsetContentType(t *testing.T) {
+	req := newPatchRequest("abc", 0, "hello")
+	req.Header.Set("Content-Type", "text/plain")
+	rr := httptest.NewRecorder()
+
+	PatchResumableUploadHandler(rr, req)
+
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code)
+}
@@ -0,0 +1,146 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/models"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+const retentionNone = "none"
+
+// parseRetention reads a retention choice made either as a duration
+// ("72h", or "none" to keep the file forever) or as an absolute RFC 3339
+// expires_at timestamp. ok is false when neither was supplied.
+func parseRetention(retention, expiresAt string) (expiry sql.NullTime, ok bool, err error) {
+	switch {
+	case retention != "" && expiresAt != "":
+		return expiry, false, errors.New("specify either retention or expires_at, not both")
+	case expiresAt != "":
+		t, err := time.Parse(time.RFC3339, expiresAt)
+		if err != nil || !t.After(time.Now()) {
+			return expiry, false, errors.New("expires_at must be a future RFC 3339 timestamp")
+		}
+		return sql.NullTime{Time: t, Valid: true}, true, nil
+	case retention == retentionNone:
+		return expiry, true, nil
+	case retention != "":
+		d, err := time.ParseDuration(retention)
+		if err != nil || d <= 0 {
+			return expiry, false, errors.New("retention must be a positive duration or \"none\"")
+		}
+		return sql.NullTime{Time: time.Now().Add(d), Valid: true}, true, nil
+	}
+	return expiry, false, nil
+}
+
+func defaultExpiry(userID int) (sql.NullTime, error) {
+	retention, enabled, err := models.GetDefaultRetention(userID)
+	if err != nil || !enabled {
+		return sql.NullTime{}, err
+	}
+	return sql.NullTime{Time: time.Now().Add(retention), Valid: true}, nil
+}
+
+func UpdateFileExpiryHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPatch {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	expiryDate, ok, err := parseRetention(r.URL.Query().Get("retention"), r.URL.Query().Get("expires_at"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		http.Error(w, "Missing retention or expires_at", http.StatusBadRequest)
+		return
+	}
+
+	err = models.SetFileExpiry(userID, fileID, expiryDate)
+	if errors.Is(err, models.ErrFileNotFound) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error updating file expiry: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	config.RedisClient.Del(config.Ctx, getFileCacheKey(fileID))
+	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", userID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"id":          fileID,
+		"expiry_date": expiryDate,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func DefaultRetentionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPut {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodPut {
+		retention := r.URL.Query().Get("retention")
+		var duration time.Duration
+		if retention != retentionNone {
+			var err error
+			duration, err = time.ParseDuration(retention)
+			if err != nil || duration <= 0 {
+				http.Error(w, "retention must be a positive duration or \"none\"", http.StatusBadRequest)
+				return
+			}
+		}
+
+		err := models.SetDefaultRetention(userID, duration, retention != retentionNone)
+		if err != nil {
+			http.Error(w, "Error saving retention policy: "+err.Error(), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	retention, enabled, err := models.GetDefaultRetention(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving retention policy: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	response := map[string]interface{}{
+		"retention": retentionNone,
+	}
+	if enabled {
+		response["retention"] = retention.String()
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(response)
+}
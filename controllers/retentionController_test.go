@@ -0,0 +1,36 @@
+package controllers
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseRetention(t *testing.T) {
+	expiry, ok, err := parseRetention("", "")
+	assert.NoError(t, err)
+	assert.False(t, ok)
+
+	expiry, ok, err = parseRetention("none", "")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.False(t, expiry.Valid)
+
+	expiry, ok, err = parseRetention("48h", "")
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.WithinDuration(t, time.Now().Add(48*time.Hour), expiry.Time, time.Minute)
+
+	future := time.Now().Add(24 * time.Hour).UTC().Truncate(time.Second)
+	expiry, ok, err = parseRetention("", future.Format(time.RFC3339))
+	assert.NoError(t, err)
+	assert.True(t, ok)
+	assert.True(t, future.Equal(expiry.Time))
+
+	_, _, err = parseRetention("-1h", "")
+	assert.Error(t, err)
+
+	_, _, err = parseRetention("1h", future.Format(time.RFC3339))
+	assert.Error(t, err)
+}
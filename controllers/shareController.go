@@ -0,0 +1,260 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/models"
+	"authentication/utils"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	defaultShareLinkDuration = 24 * time.Hour
+	shareTokenBytes          = 32
+)
+
+func ShareFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	fileIDStr := r.URL.Query().Get("id")
+	if fileIDStr == "" {
+		http.Error(w, "Missing file_id", http.StatusBadRequest)
+		return
+	}
+
+	fileID, err := strconv.Atoi(fileIDStr)
+	if err != nil {
+		http.Error(w, "Invalid file_id", http.StatusBadRequest)
+		return
+	}
+
+	file, ok := authorizeFile(w, fileID, userID, models.PermissionOwner)
+	if !ok {
+		return
+	}
+	if !requireCleanScan(w, file.ScanStatus) {
+		return
+	}
+
+	expiresAt, ok, err := parseRetention(r.URL.Query().Get("expires_in"), r.URL.Query().Get("expires_at"))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if !ok {
+		expiresAt = sql.NullTime{Time: time.Now().Add(defaultShareLinkDuration), Valid: true}
+	}
+
+	var maxDownloads *int
+	if m := r.URL.Query().Get("max_downloads"); m != "" {
+		parsed, err := strconv.Atoi(m)
+		if err != nil || parsed <= 0 {
+			http.Error(w, "Invalid max_downloads", http.StatusBadRequest)
+			return
+		}
+		maxDownloads = &parsed
+	}
+
+	var passwordHash string
+	if password := r.URL.Query().Get("password"); password != "" {
+		hashed, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+		if err != nil {
+			http.Error(w, "Error hashing password", http.StatusInternalServerError)
+			return
+		}
+		passwordHash = string(hashed)
+	}
+
+	token, err := utils.GenerateSecureToken(shareTokenBytes)
+	if err != nil {
+		http.Error(w, "Error generating share link", http.StatusInternalServerError)
+		return
+	}
+
+	link, err := models.CreateShareLink(fileID, userID, utils.HashToken(token), expiresAt, maxDownloads, passwordHash)
+	if err != nil {
+		http.Error(w, "Error creating share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", userID))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"id":            link.ID,
+		"link":          fmt.Sprintf("%s/share/%s", config.BaseURL, token),
+		"expires_at":    link.ExpiresAt,
+		"max_downloads": link.MaxDownloads,
+		"has_password":  link.HasPassword,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+// resolveShareLink looks up an active link by its token and checks the
+// password, supplied either in the X-Share-Password header or the password
+// query parameter.
+func resolveShareLink(w http.ResponseWriter, r *http.Request) (*models.ShareLink, *models.FileMetadata, bool) {
+	token := mux.Vars(r)["token"]
+	link, err := models.GetActiveShareLink(utils.HashToken(token))
+	if errors.Is(err, models.ErrShareLinkNotFound) {
+		http.Error(w, "File is not shared or the link has expired", http.StatusNotFound)
+		return nil, nil, false
+	} else if err != nil {
+		http.Error(w, "Error retrieving share link: "+err.Error(), http.StatusInternalServerError)
+		return nil, nil, false
+	}
+
+	if link.HasPassword {
+		password := r.Header.Get("X-Share-Password")
+		if password == "" {
+			password = r.URL.Query().Get("password")
+		}
+		if bcrypt.CompareHashAndPassword([]byte(link.PasswordHash), []byte(password)) != nil {
+			http.Error(w, "Invalid share link password", http.StatusUnauthorized)
+			return nil, nil, false
+		}
+	}
+
+	file, err := models.GetFileByID(link.FileID)
+	if err != nil {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return nil, nil, false
+	}
+
+	return link, file, true
+}
+
+func AccessSharedFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	link, file, ok := resolveShareLink(w, r)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"file_name":    file.FileName,
+		"file_size":    file.FileSize,
+		"file_type":    file.FileType,
+		"expires_at":   link.ExpiresAt,
+		"download_url": fmt.Sprintf("%s/share/%s/download", config.BaseURL, mux.Vars(r)["token"]),
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func DownloadSharedFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	link, file, ok := resolveShareLink(w, r)
+	if !ok {
+		return
+	}
+	if !requireCleanScan(w, file.ScanStatus) {
+		return
+	}
+
+	// Every request counts, ranged ones included: otherwise repeated range
+	// requests would fetch the file without ever using up the link.
+	err := models.RecordShareLinkDownload(link.ID)
+	if errors.Is(err, models.ErrShareLinkNotFound) {
+		http.Error(w, "File is not shared or the link has expired", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error recording download: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	serveStoredObject(w, r, file.FileName, file.FileType, file.MimeType, file.ObjectKey, file.SHA256, file.UploadDate)
+}
+
+func ListShareLinksHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := authorizeFile(w, fileID, userID, models.PermissionOwner); !ok {
+		return
+	}
+
+	links, err := models.GetActiveShareLinks(fileID)
+	if err != nil {
+		http.Error(w, "Error retrieving share links: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"links": links,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func RevokeShareLinkHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	linkID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid share link ID", http.StatusBadRequest)
+		return
+	}
+
+	err = models.RevokeShareLink(linkID, userID)
+	if errors.Is(err, models.ErrShareLinkNotFound) {
+		http.Error(w, "Share link not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error revoking share link: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", userID))
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "Share link revoked")
+}
@@ -0,0 +1,137 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/storage"
+	"authentication/utils"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func shareLinkRows() *sqlmock.Rows {
+	return sqlmock.NewRows([]string{"id", "file_id", "created_by", "created_at", "expires_at", "max_downloads", "download_count", "password_hash"})
+}
+
+func TestAccessSharedFileHandlerRequiresPassword(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	passwordHash, _ := bcrypt.GenerateFromPassword([]byte("s3cret"), bcrypt.MinCost)
+
+	for _, password := range []string{"wrong", "s3cret"} {
+		mock.ExpectQuery("SELECT (.+) FROM share_links WHERE token_hash = ").
+			WithArgs(utils.HashToken("abc")).
+			WillReturnRows(shareLinkRows().AddRow(3, 7, 1, time.Now(), nil, nil, 0, string(passwordHash)))
+		if password == "s3cret" {
+			mock.ExpectQuery("SELECT (.+) FROM files WHERE id = ").
+				WithArgs(7).
+				WillReturnRows(fileRows().
+					AddRow(7, 1, nil, "notes.txt", 5, "file:///data/1/notes.txt", "1/notes.txt", ".txt", "text/plain", "clean", time.Now(), "", 1, true, nil, nil, nil))
+		}
+
+		req := httptest.NewRequest(http.MethodGet, "/share/abc", nil)
+		req = mux.SetURLVars(req, map[string]string{"token": "abc"})
+		req.Header.Set("X-Share-Password", password)
+		rr := httptest.NewRecorder()
+
+		AccessSharedFileHandler(rr, req)
+
+		if password == "s3cret" {
+			assert.Equal(t, http.StatusOK, rr.Code)
+			assert.Contains(t, rr.Body.String(), `"file_name":"notes.txt"`)
+		} else {
+			assert.Equal(t, http.StatusUnauthorized, rr.Code)
+		}
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDownloadSharedFileHandlerExhausted(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM share_links WHERE token_hash = ").
+		WithArgs(utils.HashToken("abc")).
+		WillReturnRows(shareLinkRows().AddRow(3, 7, 1, time.Now(), nil, 1, 0, ""))
+	mock.ExpectQuery("SELECT (.+) FROM files WHERE id = ").
+		WithArgs(7).
+		WillReturnRows(fileRows().
+			AddRow(7, 1, nil, "notes.txt", 5, "file:///data/1/notes.txt", "1/notes.txt", ".txt", "text/plain", "clean", time.Now(), "", 1, true, nil, nil, nil))
+	mock.ExpectExec("UPDATE share_links SET download_count = download_count \\+ 1").
+		WithArgs(3).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	req := httptest.NewRequest(http.MethodGet, "/share/abc/download", nil)
+	req = mux.SetURLVars(req, map[string]string{"token": "abc"})
+	rr := httptest.NewRecorder()
+
+	DownloadSharedFileHandler(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDownloadSharedFileHandlerCountsRangeRequests(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+	backend.Put(context.Background(), "1/notes.txt", strings.NewReader("hello"), "")
+
+	for _, byteRange := range []string{"bytes=1-", "bytes=1-,0-"} {
+		mock.ExpectQuery("SELECT (.+) FROM share_links WHERE token_hash = ").
+			WithArgs(utils.HashToken("abc")).
+			WillReturnRows(shareLinkRows().AddRow(3, 7, 1, time.Now(), nil, 5, 0, ""))
+		mock.ExpectQuery("SELECT (.+) FROM files WHERE id = ").
+			WithArgs(7).
+			WillReturnRows(fileRows().
+				AddRow(7, 1, nil, "notes.txt", 5, backend.URL("1/notes.txt"), "1/notes.txt", ".txt", "text/plain", "clean", time.Now(), "", 1, true, nil, nil, nil))
+		mock.ExpectExec("UPDATE share_links SET download_count = download_count \\+ 1").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+
+		req := httptest.NewRequest(http.MethodGet, "/share/abc/download", nil)
+		req.Header.Set("Range", byteRange)
+		req = mux.SetURLVars(req, map[string]string{"token": "abc"})
+		rr := httptest.NewRecorder()
+
+		DownloadSharedFileHandler(rr, req)
+
+		assert.Contains(t, []int{http.StatusOK, http.StatusPartialContent}, rr.Code, byteRange)
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
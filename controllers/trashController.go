@@ -0,0 +1,104 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func DeleteFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	err = models.TrashFile(userID, fileID)
+	if errors.Is(err, models.ErrFileNotFound) {
+		http.Error(w, "File not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error moving file to trash: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	config.RedisClient.Del(config.Ctx, getFileCacheKey(fileID))
+	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", userID))
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "File moved to trash")
+}
+
+func ListTrashHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	files, err := models.GetTrashedFiles(userID)
+	if err != nil {
+		http.Error(w, "Error retrieving trash: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"files":            files,
+		"retention_period": config.TrashRetention.String(),
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func RestoreTrashedFileHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	err = models.RestoreTrashedFile(userID, fileID)
+	if errors.Is(err, models.ErrFileNotFound) {
+		http.Error(w, "File not found in trash", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error restoring file: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", userID))
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintln(w, "File restored successfully")
+}
@@ -0,0 +1,141 @@
+package controllers
+
+import (
+	"authentication/config"
+	"authentication/models"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+)
+
+func ListFileVersionsHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	if _, ok := authorizeFile(w, fileID, userID, models.PermissionRead); !ok {
+		return
+	}
+
+	versions, err := models.GetFileVersions(fileID)
+	if err != nil {
+		http.Error(w, "Error retrieving file versions: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusOK)
+	response := map[string]interface{}{
+		"versions": versions,
+	}
+	json.NewEncoder(w).Encode(response)
+}
+
+func DownloadFileVersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	versionNumber, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	file, ok := authorizeFile(w, fileID, userID, models.PermissionRead)
+	if !ok {
+		return
+	}
+
+	version, err := models.GetFileVersion(fileID, versionNumber)
+	if errors.Is(err, models.ErrVersionNotFound) {
+		http.Error(w, "File version not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error retrieving file version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if !requireCleanScan(w, version.ScanStatus) {
+		return
+	}
+
+	serveStoredObject(w, r, file.FileName, file.FileType, version.MimeType, version.ObjectKey, version.SHA256, version.CreatedAt)
+}
+
+func RestoreFileVersionHandler(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		http.Error(w, "Invalid request method", http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, ok := requestUserID(w, r)
+	if !ok {
+		return
+	}
+
+	fileID, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid file ID", http.StatusBadRequest)
+		return
+	}
+
+	versionNumber, err := strconv.Atoi(mux.Vars(r)["version"])
+	if err != nil {
+		http.Error(w, "Invalid version", http.StatusBadRequest)
+		return
+	}
+
+	file, ok := authorizeFile(w, fileID, userID, models.PermissionWrite)
+	if !ok {
+		return
+	}
+
+	version, err := models.GetFileVersion(fileID, versionNumber)
+	if errors.Is(err, models.ErrVersionNotFound) {
+		http.Error(w, "File version not found", http.StatusNotFound)
+		return
+	} else if err != nil {
+		http.Error(w, "Error retrieving file version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	err = models.RestoreFileVersion(fileID, version.Version, config.Storage.URL(version.ObjectKey))
+	if err != nil {
+		http.Error(w, "Error restoring file version: "+err.Error(), http.StatusInternalServerError)
+		return
+	}
+
+	config.RedisClient.Del(config.Ctx, getFileCacheKey(fileID))
+	config.RedisClient.Del(config.Ctx, fmt.Sprintf("user_files_%d", file.UserID))
+
+	w.WriteHeader(http.StatusOK)
+	fmt.Fprintf(w, "File restored to version %d\n", version.Version)
+}
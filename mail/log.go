@@ -0,0 +1,33 @@
+package mail
+
+import (
+	"io"
+	"sync"
+)
+
+// LogSender writes every message to w instead of delivering it, which is
+// enough to follow verification and reset links during local development.
+type LogSender struct {
+	mu   sync.Mutex
+	w    io.Writer
+	from string
+}
+
+func NewLogSender(w io.Writer, from string) *LogSender {
+	return &LogSender{w: w, from: from}
+}
+
+func (s *LogSender) Send(msg Message) error {
+	data, err := render(s.from, msg)
+	if err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.w.Write(data); err != nil {
+		return err
+	}
+	_, err = io.WriteString(s.w, "\r\n\r\n")
+	return err
+}
@@ -0,0 +1,22 @@
+package mail
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLogSender(t *testing.T) {
+	var buf bytes.Buffer
+	sender := NewLogSender(&buf, "noreply@example.com")
+
+	err := sender.Send(Message{To: "test@example.com", Subject: "Verify your email", Body: "Open\nthis link"})
+	assert.NoError(t, err)
+	assert.Contains(t, buf.String(), "To: test@example.com\r\n")
+	assert.Contains(t, buf.String(), "Subject: Verify your email\r\n")
+	assert.Contains(t, buf.String(), "Open\r\nthis link")
+
+	err = sender.Send(Message{To: "test@example.com\r\nBcc: other@example.com", Subject: "Hi"})
+	assert.ErrorIs(t, err, errHeaderInjection)
+}
@@ -0,0 +1,35 @@
+package mail
+
+import (
+	"net"
+	"net/smtp"
+)
+
+type SMTPSender struct {
+	addr string
+	from string
+	auth smtp.Auth
+}
+
+// NewSMTPSender sends through the server at addr (host:port). Credentials
+// are optional; when given, PLAIN auth is used, which net/smtp only allows
+// over TLS or to localhost.
+func NewSMTPSender(addr, username, password, from string) (*SMTPSender, error) {
+	host, _, err := net.SplitHostPort(addr)
+	if err != nil {
+		return nil, err
+	}
+	sender := &SMTPSender{addr: addr, from: from}
+	if username != "" {
+		sender.auth = smtp.PlainAuth("", username, password, host)
+	}
+	return sender, nil
+}
+
+func (s *SMTPSender) Send(msg Message) error {
+	data, err := render(s.from, msg)
+	if err != nil {
+		return err
+	}
+	return smtp.SendMail(s.addr, s.auth, s.from, []string{msg.To}, data)
+}
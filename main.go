@@ -3,6 +3,7 @@ package main
 import (
 	"authentication/config"
 	"authentication/controllers"
+	"authentication/middleware"
 	"authentication/utils"
 	"fmt"
 	"log"
@@ -13,20 +14,79 @@ import (
 
 func main() {
 	config.InitDB()
+	if err := utils.LoadSigningKeys(); err != nil {
+		log.Fatal("Failed to load JWT signing keys:", err)
+	}
 
 	go utils.DeleteExpiredFiles()
+	go utils.ScrubStoredObjects()
+	go utils.ScanUploadedObjects()
 
 	port := 8080
 
 	r := mux.NewRouter()
 
+	r.HandleFunc("/.well-known/jwks.json", controllers.JWKSHandler)
 	r.HandleFunc("/register", controllers.RegisterHandler)
 	r.HandleFunc("/login", controllers.LoginHandler)
-	r.HandleFunc("/upload", controllers.UploadFileHandler)
-	r.HandleFunc("/files", controllers.GetUserFilesHandler)
-	r.HandleFunc("/search", controllers.SearchUserFilesHandler)
-	r.HandleFunc("/share", controllers.ShareFileHandler)
-	r.HandleFunc("/share/{file_id:[0-9]+}", controllers.AccessSharedFileHandler)
+	r.HandleFunc("/login/mfa", controllers.LoginMFAHandler)
+	r.HandleFunc("/verify-email", controllers.VerifyEmailHandler)
+	r.Handle("/verify-email/resend", middleware.RequireScope(middleware.ScopeAll, controllers.ResendVerificationHandler))
+	r.HandleFunc("/password/forgot", controllers.ForgotPasswordHandler)
+	r.HandleFunc("/password/reset", controllers.ResetPasswordHandler)
+	r.HandleFunc("/token/refresh", controllers.RefreshTokenHandler)
+	r.Handle("/logout", middleware.RequireScope(middleware.ScopeAll, controllers.LogoutHandler))
+	r.Handle("/upload", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.UploadFileHandler))
+	r.Handle("/uploads/presigned", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.CreatePresignedUploadHandler))
+	r.Handle("/uploads/{id:[A-Za-z0-9_-]+}/complete", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.CompletePresignedUploadHandler))
+	r.Handle("/uploads/resumable", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.CreateResumableUploadHandler)).Methods(http.MethodPost)
+	r.Handle("/uploads/resumable/{id:[A-Za-z0-9_-]+}", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.ResumableUploadOffsetHandler)).Methods(http.MethodHead)
+	r.Handle("/uploads/resumable/{id:[A-Za-z0-9_-]+}", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.PatchResumableUploadHandler)).Methods(http.MethodPatch)
+	r.Handle("/uploads/resumable/{id:[A-Za-z0-9_-]+}", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.DeleteResumableUploadHandler)).Methods(http.MethodDelete)
+	r.Handle("/files", middleware.RequireScope(middleware.ScopeFilesRead, controllers.GetUserFilesHandler))
+	r.Handle("/files/{id:[0-9]+}", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.DeleteFileHandler))
+	r.Handle("/files/{id:[0-9]+}/download", middleware.RequireScope(middleware.ScopeFilesRead, controllers.DownloadFileHandler))
+	r.Handle("/files/{id:[0-9]+}/download-url", middleware.RequireScope(middleware.ScopeFilesRead, controllers.PresignedDownloadHandler))
+	r.Handle("/files/{id:[0-9]+}/permissions", middleware.RequireScope(middleware.ScopeShareCreate, controllers.GrantFileAccessHandler)).Methods(http.MethodPost)
+	r.Handle("/files/{id:[0-9]+}/permissions", middleware.RequireScope(middleware.ScopeFilesRead, controllers.ListFileGrantsHandler)).Methods(http.MethodGet)
+	r.Handle("/files/{id:[0-9]+}/permissions/{user_id:[0-9]+}", middleware.RequireScope(middleware.ScopeShareCreate, controllers.RevokeFileAccessHandler))
+	r.Handle("/files/{id:[0-9]+}/shares", middleware.RequireScope(middleware.ScopeFilesRead, controllers.ListShareLinksHandler))
+	r.Handle("/files/{id:[0-9]+}/expiry", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.UpdateFileExpiryHandler))
+	r.Handle("/files/{id:[0-9]+}/move", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.MoveFileHandler))
+	r.Handle("/files/{id:[0-9]+}/copy", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.CopyFileHandler))
+	r.Handle("/files/{id:[0-9]+}/versions", middleware.RequireScope(middleware.ScopeFilesRead, controllers.ListFileVersionsHandler))
+	r.Handle("/files/{id:[0-9]+}/versions/{version:[0-9]+}/download", middleware.RequireScope(middleware.ScopeFilesRead, controllers.DownloadFileVersionHandler))
+	r.Handle("/files/{id:[0-9]+}/versions/{version:[0-9]+}/restore", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.RestoreFileVersionHandler))
+	r.Handle("/shared-with-me", middleware.RequireScope(middleware.ScopeFilesRead, controllers.SharedWithMeHandler))
+	r.Handle("/me/mfa/totp", middleware.RequireScope(middleware.ScopeAll, controllers.EnrollTOTPHandler)).Methods(http.MethodPost)
+	r.Handle("/me/mfa/totp", middleware.RequireScope(middleware.ScopeAll, controllers.DisableTOTPHandler)).Methods(http.MethodDelete)
+	r.Handle("/me/mfa/totp/confirm", middleware.RequireScope(middleware.ScopeAll, controllers.ConfirmTOTPHandler))
+	r.Handle("/me/mfa/recovery-codes", middleware.RequireScope(middleware.ScopeAll, controllers.RegenerateRecoveryCodesHandler))
+	r.Handle("/me/usage", middleware.RequireScope(middleware.ScopeFilesRead, controllers.StorageUsageHandler))
+	r.Handle("/me/retention", middleware.RequireScope(middleware.ScopeAll, controllers.DefaultRetentionHandler))
+	r.Handle("/trash", middleware.RequireScope(middleware.ScopeFilesRead, controllers.ListTrashHandler))
+	r.Handle("/trash/{id:[0-9]+}/restore", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.RestoreTrashedFileHandler))
+	r.Handle("/folders", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.CreateFolderHandler))
+	r.Handle("/folders/root/children", middleware.RequireScope(middleware.ScopeFilesRead, controllers.ListFolderChildrenHandler))
+	r.Handle("/folders/{id:[0-9]+}", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.DeleteFolderHandler))
+	r.Handle("/folders/{id:[0-9]+}/rename", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.RenameFolderHandler))
+	r.Handle("/folders/{id:[0-9]+}/move", middleware.RequireScope(middleware.ScopeFilesWrite, controllers.MoveFolderHandler))
+	r.Handle("/folders/{id:[0-9]+}/children", middleware.RequireScope(middleware.ScopeFilesRead, controllers.ListFolderChildrenHandler))
+	r.Handle("/search", middleware.RequireScope(middleware.ScopeFilesRead, controllers.SearchUserFilesHandler))
+	r.Handle("/share", middleware.RequireScope(middleware.ScopeShareCreate, controllers.ShareFileHandler))
+	r.HandleFunc("/storage/local/{key:.+}", controllers.LocalStorageHandler)
+	r.HandleFunc("/share/{token}", controllers.AccessSharedFileHandler)
+	r.HandleFunc("/share/{token}/download", controllers.DownloadSharedFileHandler)
+	r.Handle("/api-keys", middleware.RequireScope(middleware.ScopeAll, controllers.CreateAPIKeyHandler)).Methods(http.MethodPost)
+	r.Handle("/api-keys", middleware.RequireScope(middleware.ScopeAll, controllers.ListAPIKeysHandler)).Methods(http.MethodGet)
+	r.Handle("/api-keys/{id:[0-9]+}", middleware.RequireScope(middleware.ScopeAll, controllers.RevokeAPIKeyHandler))
+	r.Handle("/admin/users/{id:[0-9]+}/unlock", middleware.RequireAdmin(controllers.UnlockAccountHandler))
+	r.Handle("/admin/users/{id:[0-9]+}/quota", middleware.RequireAdmin(controllers.SetUserQuotaHandler))
+	r.Handle("/admin/corrupt-files", middleware.RequireAdmin(controllers.ListCorruptFilesHandler))
+	r.Handle("/admin/mime-rules", middleware.RequireAdmin(controllers.ListMIMERulesHandler)).Methods(http.MethodGet)
+	r.Handle("/admin/mime-rules", middleware.RequireAdmin(controllers.SaveMIMERuleHandler)).Methods(http.MethodPost)
+	r.Handle("/admin/mime-rules/{id:[0-9]+}", middleware.RequireAdmin(controllers.DeleteMIMERuleHandler)).Methods(http.MethodDelete)
+	r.Handle("/shares/{id:[0-9]+}", middleware.RequireScope(middleware.ScopeShareCreate, controllers.RevokeShareLinkHandler))
 
 	fmt.Printf("Server started on port %d\n", port)
 
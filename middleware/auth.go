@@ -0,0 +1,167 @@
+package middleware
+
+import (
+	"authentication/models"
+	"authentication/utils"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	ScopeAll         = "*"
+	ScopeFilesRead   = "files:read"
+	ScopeFilesWrite  = "files:write"
+	ScopeShareCreate = "share:create"
+)
+
+// APIKeyScopes lists the scopes an API key may be granted. Keys can never
+// hold ScopeAll, which is reserved for interactive sessions.
+var APIKeyScopes = []string{ScopeFilesRead, ScopeFilesWrite, ScopeShareCreate}
+
+var errNoCredentials = errors.New("no credentials supplied")
+
+type Principal struct {
+	UserID    int
+	Email     string
+	Scopes    []string
+	TokenID   string
+	ExpiresAt time.Time
+}
+
+func (p *Principal) HasScope(scope string) bool {
+	for _, s := range p.Scopes {
+		if s == scope || s == ScopeAll {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey int
+
+const principalKey contextKey = iota
+
+func WithPrincipal(ctx context.Context, principal *Principal) context.Context {
+	return context.WithValue(ctx, principalKey, principal)
+}
+
+func PrincipalFromContext(ctx context.Context) (*Principal, bool) {
+	principal, ok := ctx.Value(principalKey).(*Principal)
+	return principal, ok && principal != nil
+}
+
+func credentialsFromRequest(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return strings.TrimSpace(key)
+	}
+	if header := r.Header.Get("Authorization"); header != "" {
+		if token, ok := strings.CutPrefix(header, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	if cookie, err := r.Cookie("token"); err == nil {
+		return cookie.Value
+	}
+	return ""
+}
+
+func authenticate(r *http.Request) (*Principal, error) {
+	tokenString := credentialsFromRequest(r)
+	if tokenString == "" {
+		return nil, errNoCredentials
+	}
+	if utils.IsAPIKey(tokenString) {
+		return authenticateAPIKey(tokenString)
+	}
+
+	claims, err := utils.ParseToken(tokenString)
+	if err != nil {
+		return nil, err
+	}
+	if claims.Purpose != "" {
+		return nil, errors.New("token is not valid for API access")
+	}
+
+	userID := claims.UserID
+	if userID == 0 {
+		// Tokens issued before the uid claim existed still need a lookup.
+		userID, err = utils.GetUserIdFromToken(tokenString)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	scopes := claims.Scopes
+	if len(scopes) == 0 {
+		scopes = []string{ScopeAll}
+	}
+
+	return &Principal{
+		UserID:    userID,
+		Email:     claims.Email,
+		Scopes:    scopes,
+		TokenID:   claims.Id,
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}, nil
+}
+
+func authenticateAPIKey(key string) (*Principal, error) {
+	apiKey, email, err := models.GetActiveAPIKey(utils.HashToken(key))
+	if err != nil {
+		return nil, err
+	}
+	if err := models.TouchAPIKey(apiKey.ID); err != nil {
+		log.Printf("Failed to record use of API key %d: %v", apiKey.ID, err)
+	}
+	return &Principal{UserID: apiKey.UserID, Email: email, Scopes: apiKey.Scopes}, nil
+}
+
+// RequireAuth rejects requests without valid credentials and otherwise makes
+// the caller's Principal available through PrincipalFromContext.
+func RequireAuth(next http.HandlerFunc) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := authenticate(r)
+		if errors.Is(err, errNoCredentials) {
+			http.Error(w, "Authentication required", http.StatusUnauthorized)
+			return
+		} else if err != nil {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		next(w, r.WithContext(WithPrincipal(r.Context(), principal)))
+	})
+}
+
+// RequireScope is RequireAuth for routes that API keys may only call when
+// they were granted the given scope.
+func RequireScope(scope string, next http.HandlerFunc) http.Handler {
+	return RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFromContext(r.Context())
+		if !principal.HasScope(scope) {
+			http.Error(w, "Insufficient scope: "+scope+" is required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
+
+// RequireAdmin limits a route to interactive sessions of administrators.
+func RequireAdmin(next http.HandlerFunc) http.Handler {
+	return RequireScope(ScopeAll, func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := PrincipalFromContext(r.Context())
+		isAdmin, err := models.IsAdmin(principal.UserID)
+		if err != nil {
+			http.Error(w, "Error checking permissions", http.StatusInternalServerError)
+			return
+		}
+		if !isAdmin {
+			http.Error(w, "Administrator access required", http.StatusForbidden)
+			return
+		}
+		next(w, r)
+	})
+}
@@ -0,0 +1,132 @@
+package middleware
+
+import (
+	"authentication/config"
+	"authentication/utils"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func signedToken(t *testing.T, userID int) string {
+	token, err := utils.GenerateJWT(&utils.Claims{
+		Email:  "test@example.com",
+		UserID: userID,
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	})
+	assert.NoError(t, err)
+	return token
+}
+
+func TestRequireAuth(t *testing.T) {
+	var got *Principal
+	handler := RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/files", nil)
+	req.Header.Set("Authorization", "Bearer "+signedToken(t, 7))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, 7, got.UserID)
+		assert.Equal(t, "test@example.com", got.Email)
+		assert.True(t, got.HasScope("files:read"))
+	}
+
+	got = nil
+	req = httptest.NewRequest(http.MethodGet, "/files", nil)
+	req.AddCookie(&http.Cookie{Name: "token", Value: signedToken(t, 7)})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.NotNil(t, got)
+}
+
+func TestRequireAuthRejects(t *testing.T) {
+	handler := RequireAuth(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatal("handler should not be called")
+	})
+
+	req := httptest.NewRequest(http.MethodGet, "/files", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Authentication required")
+
+	config.RedisClient = redis.NewClient(&redis.Options{Addr: miniredis.RunT(t).Addr()})
+	defer func() { config.RedisClient = nil }()
+	challenge, err := utils.IssueMFAChallenge(7, "test@example.com")
+	assert.NoError(t, err)
+	req = httptest.NewRequest(http.MethodGet, "/files", nil)
+	req.Header.Set("Authorization", "Bearer "+challenge)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+
+	req = httptest.NewRequest(http.MethodGet, "/files", nil)
+	req.Header.Set("Authorization", "Bearer not-a-token")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnauthorized, rr.Code)
+	assert.Contains(t, rr.Body.String(), "Invalid token")
+}
+
+func TestRequireScopeWithAPIKey(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	key, prefix, err := utils.GenerateAPIKey()
+	assert.NoError(t, err)
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT (.+) FROM api_keys k").
+			WithArgs(utils.HashToken(key)).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "name", "key_prefix", "scopes", "created_at", "last_used_at", "email"}).
+				AddRow(3, 7, "ci", prefix, "{files:read}", time.Now(), nil, "test@example.com"))
+		mock.ExpectExec("UPDATE api_keys SET last_used_at").
+			WithArgs(3).
+			WillReturnResult(sqlmock.NewResult(0, 1))
+	}
+
+	var got *Principal
+	next := func(w http.ResponseWriter, r *http.Request) {
+		got, _ = PrincipalFromContext(r.Context())
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/files", nil)
+	req.Header.Set("Authorization", "Bearer "+key)
+	rr := httptest.NewRecorder()
+	RequireScope(ScopeFilesRead, next).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	if assert.NotNil(t, got) {
+		assert.Equal(t, 7, got.UserID)
+		assert.Equal(t, []string{ScopeFilesRead}, got.Scopes)
+	}
+
+	got = nil
+	req = httptest.NewRequest(http.MethodPost, "/upload", nil)
+	req.Header.Set("X-API-Key", key)
+	rr = httptest.NewRecorder()
+	RequireScope(ScopeFilesWrite, next).ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusForbidden, rr.Code)
+	assert.Nil(t, got)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,110 @@
+package models
+
+import (
+	"authentication/config"
+	"database/sql"
+	"errors"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var ErrAPIKeyNotFound = errors.New("API key not found")
+
+type APIKey struct {
+	ID         int          `json:"id"`
+	UserID     int          `json:"-"`
+	Name       string       `json:"name"`
+	Prefix     string       `json:"prefix"`
+	Scopes     []string     `json:"scopes"`
+	CreatedAt  time.Time    `json:"created_at"`
+	LastUsedAt sql.NullTime `json:"last_used_at"`
+}
+
+const apiKeyColumns = `id, user_id, name, key_prefix, scopes, created_at, last_used_at`
+
+func scanAPIKey(row rowScanner) (*APIKey, error) {
+	var key APIKey
+	err := row.Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedAt, &key.LastUsedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &key, nil
+}
+
+func CreateAPIKey(userID int, name, prefix, keyHash string, scopes []string) (*APIKey, error) {
+	return scanAPIKey(config.DB.QueryRow(`
+		INSERT INTO api_keys (user_id, name, key_prefix, key_hash, scopes)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING `+apiKeyColumns,
+		userID, name, prefix, keyHash, pq.Array(scopes),
+	))
+}
+
+func GetAPIKeys(userID int) ([]APIKey, error) {
+	rows, err := config.DB.Query(`
+		SELECT `+apiKeyColumns+`
+		FROM api_keys
+		WHERE user_id = $1 AND revoked_at IS NULL
+		ORDER BY created_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *key)
+	}
+	return keys, rows.Err()
+}
+
+// GetActiveAPIKey looks a key up by hash and returns it together with the
+// owner's email.
+func GetActiveAPIKey(keyHash string) (*APIKey, string, error) {
+	var key APIKey
+	var email string
+	err := config.DB.QueryRow(`
+		SELECT k.id, k.user_id, k.name, k.key_prefix, k.scopes, k.created_at, k.last_used_at, u.email
+		FROM api_keys k
+		JOIN users u ON u.id = k.user_id
+		WHERE k.key_hash = $1 AND k.revoked_at IS NULL`,
+		keyHash,
+	).Scan(&key.ID, &key.UserID, &key.Name, &key.Prefix, pq.Array(&key.Scopes), &key.CreatedAt, &key.LastUsedAt, &email)
+	if err == sql.ErrNoRows {
+		return nil, "", ErrAPIKeyNotFound
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return &key, email, nil
+}
+
+// TouchAPIKey records that a key was used. Writes are throttled to one a
+// minute so busy pipelines do not update the row on every request.
+func TouchAPIKey(keyID int) error {
+	_, err := config.DB.Exec(`
+		UPDATE api_keys SET last_used_at = NOW()
+		WHERE id = $1 AND (last_used_at IS NULL OR last_used_at < NOW() - INTERVAL '1 minute')`,
+		keyID,
+	)
+	return err
+}
+
+func RevokeAPIKey(keyID, userID int) error {
+	result, err := config.DB.Exec(`
+		UPDATE api_keys SET revoked_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND revoked_at IS NULL`,
+		keyID, userID,
+	)
+	return requireAffected(result, err, ErrAPIKeyNotFound)
+}
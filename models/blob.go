@@ -0,0 +1,55 @@
+package models
+
+import (
+	"authentication/config"
+	"database/sql"
+)
+
+// AcquireBlob takes a reference to the content hashed as contentSHA256. If
+// identical content is already stored, its object key is returned and the
+// caller's copy at objectKey is redundant; otherwise objectKey becomes the
+// blob. Every file version holds one reference. Blobs flagged as corrupted
+// are never reused.
+func AcquireBlob(contentSHA256, objectKey string, size int64) (string, error) {
+	if contentSHA256 == "" {
+		return objectKey, nil
+	}
+
+	var storedKey string
+	err := config.DB.QueryRow(`
+		INSERT INTO blobs (object_key, content_sha256, file_size, ref_count)
+		VALUES ($1, $2, $3, 1)
+		ON CONFLICT (content_sha256) WHERE corrupted_at IS NULL DO UPDATE SET ref_count = blobs.ref_count + 1
+		RETURNING object_key`,
+		objectKey, contentSHA256, size,
+	).Scan(&storedKey)
+	return storedKey, err
+}
+
+// ReleaseBlob drops a reference to the blob at objectKey and reports whether
+// the object is no longer referenced and should be deleted from storage.
+// Objects without a blob row predate deduplication and have a single owner.
+func ReleaseBlob(objectKey string) (bool, error) {
+	var refCount int
+	err := config.DB.QueryRow(`
+		UPDATE blobs SET ref_count = ref_count - 1
+		WHERE object_key = $1
+		RETURNING ref_count`,
+		objectKey,
+	).Scan(&refCount)
+	if err == sql.ErrNoRows {
+		return true, nil
+	}
+	if err != nil || refCount > 0 {
+		return false, err
+	}
+
+	// A concurrent AcquireBlob may have revived the blob in the meantime, in
+	// which case nothing is deleted.
+	result, err := config.DB.Exec(`DELETE FROM blobs WHERE object_key = $1 AND ref_count <= 0`, objectKey)
+	if err != nil {
+		return false, err
+	}
+	deleted, err := result.RowsAffected()
+	return deleted > 0, err
+}
@@ -0,0 +1,73 @@
+package models
+
+import (
+	"authentication/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAcquireBlobReturnsExistingObject(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	mock.ExpectQuery("INSERT INTO blobs").
+		WithArgs("1/new.txt", "abc", int64(11)).
+		WillReturnRows(sqlmock.NewRows([]string{"object_key"}).AddRow("1/original.txt"))
+
+	storedKey, err := AcquireBlob("abc", "1/new.txt", 11)
+
+	assert.NoError(t, err)
+	assert.Equal(t, "1/original.txt", storedKey)
+
+	storedKey, err = AcquireBlob("", "1/legacy.txt", 11)
+	assert.NoError(t, err)
+	assert.Equal(t, "1/legacy.txt", storedKey)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestReleaseBlob(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	mock.ExpectQuery("UPDATE blobs SET ref_count = ref_count - 1").
+		WithArgs("1/shared.txt").
+		WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(1))
+	mock.ExpectQuery("UPDATE blobs SET ref_count = ref_count - 1").
+		WithArgs("1/shared.txt").
+		WillReturnRows(sqlmock.NewRows([]string{"ref_count"}).AddRow(0))
+	mock.ExpectExec("DELETE FROM blobs").
+		WithArgs("1/shared.txt").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectQuery("UPDATE blobs SET ref_count = ref_count - 1").
+		WithArgs("1/legacy.txt").
+		WillReturnRows(sqlmock.NewRows([]string{"ref_count"}))
+
+	orphaned, err := ReleaseBlob("1/shared.txt")
+	assert.NoError(t, err)
+	assert.False(t, orphaned)
+
+	orphaned, err = ReleaseBlob("1/shared.txt")
+	assert.NoError(t, err)
+	assert.True(t, orphaned)
+
+	orphaned, err = ReleaseBlob("1/legacy.txt")
+	assert.NoError(t, err)
+	assert.True(t, orphaned)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -3,10 +3,13 @@ package models
 import (
 	"authentication/config"
 	"database/sql"
+	"errors"
 	"fmt"
 	"time"
 )
 
+var ErrFileNotFound = errors.New("file not found")
+
 type File struct {
 	ID         int       `json:"id"`
 	UserID     int       `json:"user_id"`
@@ -23,62 +26,109 @@ type FileMetadata struct {
 	FileName   string       `json:"file_name"`
 	FileSize   int          `json:"file_size"`
 	FileURL    string       `json:"s3_url"`
+	ObjectKey  string       `json:"-"`
+	FolderID   *int         `json:"folder_id"`
 	FileType   string       `json:"file_extension"`
+	MimeType   string       `json:"mime_type"`
+	ScanStatus string       `json:"scan_status"`
+	UploadDate time.Time    `json:"upload_date"`
+	SHA256     string       `json:"content_sha256"`
+	Version    int          `json:"version"`
 	SharedUser bool         `json:"shared_user"`
 	SharedAt   sql.NullTime `json:"shared_at"`
 	ExpiryDate sql.NullTime `json:"expiry_date"`
+	DeletedAt  sql.NullTime `json:"deleted_at"`
 }
 
-func SaveFileMetadata(userID int, fileName string, fileSize int, fileURL, fileExtension string, sharedUser bool, expiryDate time.Time) (int, error) {
-	var fileID int
-	err := config.DB.QueryRow(`
-        INSERT INTO files (user_id, file_name, file_size, s3_url, file_extension, shared_user, shared_at, expiry_date)
-        VALUES ($1, $2, $3, $4, $5, $6, $7, $8) RETURNING id`,
-		userID, fileName, fileSize, fileURL, fileExtension, sharedUser, time.Now(), expiryDate,
-	).Scan(&fileID)
-	return fileID, err
+const fileColumns = `id, user_id, folder_id, file_name, file_size, s3_url, object_key, file_extension, mime_type, scan_status, upload_date, content_sha256, current_version, shared_user, shared_at, expiry_date, deleted_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
 }
 
-func GetUserFiles(userID int) ([]FileMetadata, error) {
-	rows, err := config.DB.Query(`
-		SELECT id, user_id, file_name, file_size, s3_url, file_extension, shared_user, shared_at
-		FROM files
-		WHERE user_id = $1`, userID)
+func scanFile(row rowScanner, extra ...interface{}) (*FileMetadata, error) {
+	var file FileMetadata
+	dest := []interface{}{&file.FileID, &file.UserID, &file.FolderID, &file.FileName, &file.FileSize, &file.FileURL, &file.ObjectKey, &file.FileType, &file.MimeType, &file.ScanStatus,
+		&file.UploadDate, &file.SHA256, &file.Version, &file.SharedUser, &file.SharedAt, &file.ExpiryDate, &file.DeletedAt}
+	err := row.Scan(append(dest, extra...)...)
 	if err != nil {
 		return nil, err
 	}
+	return &file, nil
+}
+
+func scanFiles(rows *sql.Rows) ([]FileMetadata, error) {
 	defer rows.Close()
 
 	var files []FileMetadata
 	for rows.Next() {
-		var file FileMetadata
-		err := rows.Scan(&file.FileID, &file.UserID, &file.FileName, &file.FileSize, &file.FileURL, &file.FileType, &file.SharedUser, &file.SharedAt)
+		file, err := scanFile(rows)
 		if err != nil {
-			return nil, err
+			return nil, fmt.Errorf("error scanning row: %w", err)
 		}
-		files = append(files, file)
+		files = append(files, *file)
 	}
-	if err = rows.Err(); err != nil {
-		return nil, err
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over rows: %w", err)
 	}
 	return files, nil
 }
 
-func UpdateFileName(userID, fileID int, newName string) error {
+func SaveFileMetadata(file *FileMetadata) (int, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var fileID int
+	err = tx.QueryRow(`
+        INSERT INTO files (user_id, folder_id, file_name, file_size, s3_url, object_key, file_extension, mime_type, scan_status, content_sha256, shared_user, shared_at, expiry_date)
+        VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13) RETURNING id`,
+		file.UserID, file.FolderID, file.FileName, file.FileSize, file.FileURL, file.ObjectKey, file.FileType, file.MimeType, file.ScanStatus, file.SHA256, file.SharedUser, time.Now(), file.ExpiryDate,
+	).Scan(&fileID)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO file_versions (file_id, version, object_key, file_size, content_sha256, mime_type, scan_status)
+		VALUES ($1, 1, $2, $3, $4, $5, $6)`,
+		fileID, file.ObjectKey, file.FileSize, file.SHA256, file.MimeType, file.ScanStatus,
+	)
+	if err != nil {
+		return 0, err
+	}
+
+	return fileID, tx.Commit()
+}
+
+func GetUserFiles(userID int) ([]FileMetadata, error) {
+	rows, err := config.DB.Query(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE user_id = $1 AND deleted_at IS NULL`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanFiles(rows)
+}
+
+func UpdateFileName(fileID int, newName string) error {
 	_, err := config.DB.Exec(`
 		UPDATE files
 		SET file_name = $1
-		WHERE user_id = $2 AND id = $3`,
-		newName, userID, fileID,
+		WHERE id = $2 AND deleted_at IS NULL`,
+		newName, fileID,
 	)
 	return err
 }
 
 func SearchUserFiles(userID int, fileName, uploadDate, fileType string, limit, offset int) ([]FileMetadata, error) {
 	query := `
-		SELECT id, file_name, file_size, s3_url, file_extension, shared_user
+		SELECT ` + fileColumns + `
 		FROM files
-		WHERE user_id = $1
+		WHERE user_id = $1 AND deleted_at IS NULL
 	`
 
 	params := []interface{}{userID}
@@ -107,56 +157,35 @@ func SearchUserFiles(userID int, fileName, uploadDate, fileType string, limit, o
 	if err != nil {
 		return nil, fmt.Errorf("error querying the database: %w", err)
 	}
-	defer rows.Close()
-
-	var files []FileMetadata
-
-	for rows.Next() {
-		var file FileMetadata
-		if err := rows.Scan(&file.FileID, &file.FileName, &file.FileSize, &file.FileURL, &file.FileType, &file.SharedUser); err != nil {
-			return nil, fmt.Errorf("error scanning row: %w", err)
-		}
-		files = append(files, file)
-	}
-
-	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over rows: %w", err)
-	}
-
-	return files, nil
-}
-
-func UpdateSharedStatus(fileID int, userID int, sharedUser bool, sharedAt time.Time) error {
-	_, err := config.DB.Exec(`
-        UPDATE files
-        SET shared_user = $1, shared_at = $2
-        WHERE id = $3 AND user_id = $4`,
-		sharedUser, sharedAt, fileID, userID)
-	return err
+	return scanFiles(rows)
 }
 
-func SetTemporaryLinkExpiry(fileID int, duration time.Duration) error {
-	go func() {
-		time.Sleep(duration)
-		err := UpdateSharedStatus(fileID, 0, false, time.Now())
-		if err != nil {
-			fmt.Printf("Error resetting shared_user status for file_id %d: %v\n", fileID, err)
-		}
-	}()
-	return nil
+func SetFileExpiry(userID, fileID int, expiryDate sql.NullTime) error {
+	result, err := config.DB.Exec(`
+		UPDATE files
+		SET expiry_date = $1
+		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL`,
+		expiryDate, fileID, userID,
+	)
+	return requireAffected(result, err, ErrFileNotFound)
 }
 
 func GetFileByID(fileID int) (*FileMetadata, error) {
-	var file FileMetadata
-
-	err := config.DB.QueryRow(`
-        SELECT id, file_name, file_size, s3_url, file_extension, shared_user, shared_at 
-        FROM files 
-        WHERE id = $1`, fileID).
-		Scan(&file.FileID, &file.FileName, &file.FileSize, &file.FileURL, &file.FileType, &file.SharedUser, &file.SharedAt)
+	row := config.DB.QueryRow(`
+        SELECT `+fileColumns+`
+        FROM files
+        WHERE id = $1 AND deleted_at IS NULL`, fileID)
+	return scanFile(row)
+}
 
+func GetExpiredFiles() ([]FileMetadata, error) {
+	rows, err := config.DB.Query(`
+		SELECT ` + fileColumns + `
+		FROM files
+		WHERE expiry_date <= NOW()
+	`)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("error querying expired files: %w", err)
 	}
-	return &file, nil
+	return scanFiles(rows)
 }
@@ -2,6 +2,7 @@ package models
 
 import (
 	"authentication/config"
+	"database/sql"
 	"testing"
 	"time"
 
@@ -17,11 +18,27 @@ func TestSaveFileMetadata(t *testing.T) {
 	config.DB = db
 	defer db.Close()
 
+	mock.ExpectBegin()
 	mock.ExpectQuery("INSERT INTO files").
-		WithArgs(1, "testfile.txt", 1234, "s3://bucket/testfile.txt", "txt", false, sqlmock.AnyArg(), sqlmock.AnyArg()).
+		WithArgs(1, nil, "testfile.txt", 1234, "s3://bucket/1/key.txt", "1/key.txt", "txt", "text/plain", "pending", "abc123", false, sqlmock.AnyArg(), sqlmock.AnyArg()).
 		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(1))
+	mock.ExpectExec("INSERT INTO file_versions").
+		WithArgs(1, sqlmock.AnyArg(), sqlmock.AnyArg(), sqlmock.AnyArg(), "text/plain", "pending").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectCommit()
 
-	fileID, err := SaveFileMetadata(1, "testfile.txt", 1234, "s3://bucket/testfile.txt", "txt", false, time.Now())
+	fileID, err := SaveFileMetadata(&FileMetadata{
+		UserID:     1,
+		FileName:   "testfile.txt",
+		FileSize:   1234,
+		FileURL:    "s3://bucket/1/key.txt",
+		ObjectKey:  "1/key.txt",
+		FileType:   "txt",
+		MimeType:   "text/plain",
+		ScanStatus: ScanStatusPending,
+		SHA256:     "abc123",
+		ExpiryDate: sql.NullTime{Time: time.Now(), Valid: true},
+	})
 
 	assert.NoError(t, err)
 	assert.Equal(t, 1, fileID)
@@ -0,0 +1,238 @@
+package models
+
+import (
+	"authentication/config"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+var (
+	ErrFolderNotFound = errors.New("folder not found")
+	ErrFolderNotEmpty = errors.New("folder is not empty")
+	ErrFolderCycle    = errors.New("folder cannot be moved into itself or one of its subfolders")
+	ErrFolderExists   = errors.New("a folder with that name already exists")
+)
+
+// checkFolderName reports a clash with the unique folder name index as
+// ErrFolderExists.
+func checkFolderName(err error) error {
+	var pqErr *pq.Error
+	if errors.As(err, &pqErr) && pqErr.Code == "23505" && pqErr.Constraint == "folders_user_parent_name_idx" {
+		return ErrFolderExists
+	}
+	return err
+}
+
+type Folder struct {
+	ID        int       `json:"id"`
+	UserID    int       `json:"user_id"`
+	ParentID  *int      `json:"parent_id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+const folderColumns = `id, user_id, parent_id, name, created_at`
+
+func scanFolder(row rowScanner) (*Folder, error) {
+	var folder Folder
+	err := row.Scan(&folder.ID, &folder.UserID, &folder.ParentID, &folder.Name, &folder.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrFolderNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &folder, nil
+}
+
+func scanFolders(rows *sql.Rows) ([]Folder, error) {
+	defer rows.Close()
+
+	var folders []Folder
+	for rows.Next() {
+		folder, err := scanFolder(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning folder: %w", err)
+		}
+		folders = append(folders, *folder)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over folders: %w", err)
+	}
+	return folders, nil
+}
+
+func CreateFolder(userID int, parentID *int, name string) (*Folder, error) {
+	row := config.DB.QueryRow(`
+		INSERT INTO folders (user_id, parent_id, name)
+		VALUES ($1, $2, $3)
+		RETURNING `+folderColumns,
+		userID, parentID, name,
+	)
+	folder, err := scanFolder(row)
+	return folder, checkFolderName(err)
+}
+
+func GetFolder(userID, folderID int) (*Folder, error) {
+	row := config.DB.QueryRow(`
+		SELECT `+folderColumns+`
+		FROM folders
+		WHERE id = $1 AND user_id = $2`,
+		folderID, userID,
+	)
+	return scanFolder(row)
+}
+
+func RenameFolder(userID, folderID int, name string) error {
+	result, err := config.DB.Exec(`
+		UPDATE folders
+		SET name = $1
+		WHERE id = $2 AND user_id = $3`,
+		name, folderID, userID,
+	)
+	return requireAffected(result, checkFolderName(err), ErrFolderNotFound)
+}
+
+func MoveFolder(userID, folderID int, parentID *int) error {
+	if parentID != nil {
+		var cycle bool
+		err := config.DB.QueryRow(`
+			WITH RECURSIVE ancestors AS (
+				SELECT id, parent_id FROM folders WHERE id = $1 AND user_id = $2
+				UNION ALL
+				SELECT f.id, f.parent_id FROM folders f JOIN ancestors a ON f.id = a.parent_id
+			)
+			SELECT EXISTS (SELECT 1 FROM ancestors WHERE id = $3)`,
+			*parentID, userID, folderID,
+		).Scan(&cycle)
+		if err != nil {
+			return fmt.Errorf("error checking folder ancestry: %w", err)
+		}
+		if cycle {
+			return ErrFolderCycle
+		}
+	}
+
+	result, err := config.DB.Exec(`
+		UPDATE folders
+		SET parent_id = $1
+		WHERE id = $2 AND user_id = $3`,
+		parentID, folderID, userID,
+	)
+	return requireAffected(result, checkFolderName(err), ErrFolderNotFound)
+}
+
+func DeleteFolder(userID, folderID int) error {
+	if _, err := GetFolder(userID, folderID); err != nil {
+		return err
+	}
+
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE files
+		SET folder_id = NULL
+		WHERE folder_id = $1 AND deleted_at IS NOT NULL`,
+		folderID,
+	)
+	if err != nil {
+		return err
+	}
+
+	result, err := tx.Exec(`
+		DELETE FROM folders
+		WHERE id = $1 AND user_id = $2
+		AND NOT EXISTS (SELECT 1 FROM folders WHERE parent_id = $1)
+		AND NOT EXISTS (SELECT 1 FROM files WHERE folder_id = $1)`,
+		folderID, userID,
+	)
+	if err := requireAffected(result, err, ErrFolderNotEmpty); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func ListFolderChildren(userID int, folderID *int) ([]Folder, []FileMetadata, error) {
+	rows, err := config.DB.Query(`
+		SELECT `+folderColumns+`
+		FROM folders
+		WHERE user_id = $1 AND parent_id IS NOT DISTINCT FROM $2
+		ORDER BY name`,
+		userID, folderID,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying folders: %w", err)
+	}
+	folders, err := scanFolders(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	rows, err = config.DB.Query(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE user_id = $1 AND folder_id IS NOT DISTINCT FROM $2 AND deleted_at IS NULL
+		ORDER BY file_name`,
+		userID, folderID,
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("error querying files: %w", err)
+	}
+	files, err := scanFiles(rows)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return folders, files, nil
+}
+
+func GetFolderBreadcrumbs(userID, folderID int) ([]Folder, error) {
+	rows, err := config.DB.Query(`
+		WITH RECURSIVE ancestors AS (
+			SELECT `+folderColumns+`, 0 AS depth FROM folders WHERE id = $1 AND user_id = $2
+			UNION ALL
+			SELECT f.id, f.user_id, f.parent_id, f.name, f.created_at, a.depth + 1
+			FROM folders f JOIN ancestors a ON f.id = a.parent_id
+		)
+		SELECT `+folderColumns+`
+		FROM ancestors
+		ORDER BY depth DESC`,
+		folderID, userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying breadcrumbs: %w", err)
+	}
+	return scanFolders(rows)
+}
+
+func MoveFile(userID, fileID int, folderID *int) error {
+	result, err := config.DB.Exec(`
+		UPDATE files
+		SET folder_id = $1
+		WHERE id = $2 AND user_id = $3 AND deleted_at IS NULL`,
+		folderID, fileID, userID,
+	)
+	return requireAffected(result, err, ErrFileNotFound)
+}
+
+func requireAffected(result sql.Result, err error, notFound error) error {
+	if err != nil {
+		return err
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return notFound
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+package models
+
+import (
+	"authentication/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMoveFolderRejectsCycle(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	mock.ExpectQuery("WITH RECURSIVE ancestors").
+		WithArgs(5, 1, 2).
+		WillReturnRows(sqlmock.NewRows([]string{"exists"}).AddRow(true))
+
+	parentID := 5
+	err = MoveFolder(1, 2, &parentID)
+
+	assert.ErrorIs(t, err, ErrFolderCycle)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestDeleteFolderNotEmpty(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	mock.ExpectQuery("SELECT (.+) FROM folders").
+		WithArgs(2, 1).
+		WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "parent_id", "name", "created_at"}).
+			AddRow(2, 1, nil, "Invoices", time.Now()))
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE files SET folder_id = NULL").
+		WithArgs(2).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectExec("DELETE FROM folders").
+		WithArgs(2, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+	mock.ExpectRollback()
+
+	err = DeleteFolder(1, 2)
+
+	assert.ErrorIs(t, err, ErrFolderNotEmpty)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
+
+func TestCreateFolderDuplicateName(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	mock.ExpectQuery("INSERT INTO folders").
+		WithArgs(1, nil, "Invoices").
+		WillReturnError(&pq.Error{Code: "23505", Constraint: "folders_user_parent_name_idx"})
+
+	_, err = CreateFolder(1, nil, "Invoices")
+
+	assert.ErrorIs(t, err, ErrFolderExists)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"authentication/config"
+	"time"
+)
+
+// StoredObject is an object in storage together with the SHA-256 its
+// content had when it was uploaded.
+type StoredObject struct {
+	ObjectKey string
+	SHA256    string
+}
+
+type CorruptVersion struct {
+	FileID      int       `json:"file_id"`
+	UserID      int       `json:"user_id"`
+	FileName    string    `json:"file_name"`
+	Version     int       `json:"version"`
+	SHA256      string    `json:"content_sha256"`
+	CorruptedAt time.Time `json:"corrupted_at"`
+}
+
+// GetObjectsDueForVerification returns objects that have never been checked
+// or were last checked before the given time, least recently checked first.
+func GetObjectsDueForVerification(checkedBefore time.Time, limit int) ([]StoredObject, error) {
+	rows, err := config.DB.Query(`
+		SELECT object_key, content_sha256
+		FROM file_versions
+		WHERE content_sha256 <> '' AND (verified_at IS NULL OR verified_at < $1)
+		GROUP BY object_key, content_sha256
+		ORDER BY MIN(verified_at) ASC NULLS FIRST
+		LIMIT $2`,
+		checkedBefore, limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var objects []StoredObject
+	for rows.Next() {
+		var object StoredObject
+		if err := rows.Scan(&object.ObjectKey, &object.SHA256); err != nil {
+			return nil, err
+		}
+		objects = append(objects, object)
+	}
+	return objects, rows.Err()
+}
+
+// RecordVerification stores the outcome of checking an object on every
+// version that uses it. A corrupted blob also stops being offered for
+// deduplication.
+func RecordVerification(objectKey string, intact bool) error {
+	_, err := config.DB.Exec(`
+		UPDATE file_versions
+		SET verified_at = NOW(),
+			corrupted_at = CASE WHEN $2 THEN NULL ELSE COALESCE(corrupted_at, NOW()) END
+		WHERE object_key = $1`,
+		objectKey, intact,
+	)
+	if err != nil || intact {
+		return err
+	}
+
+	_, err = config.DB.Exec(`UPDATE blobs SET corrupted_at = COALESCE(corrupted_at, NOW()) WHERE object_key = $1`, objectKey)
+	return err
+}
+
+func GetCorruptVersions() ([]CorruptVersion, error) {
+	rows, err := config.DB.Query(`
+		SELECT f.id, f.user_id, f.file_name, v.version, v.content_sha256, v.corrupted_at
+		FROM file_versions v
+		JOIN files f ON f.id = v.file_id
+		WHERE v.corrupted_at IS NOT NULL
+		ORDER BY v.corrupted_at DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []CorruptVersion{}
+	for rows.Next() {
+		var version CorruptVersion
+		err := rows.Scan(&version.FileID, &version.UserID, &version.FileName, &version.Version, &version.SHA256, &version.CorruptedAt)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
@@ -0,0 +1,135 @@
+package models
+
+import (
+	"authentication/config"
+	"database/sql"
+	"errors"
+)
+
+var (
+	ErrMFAAlreadyEnabled   = errors.New("two-factor authentication is already enabled")
+	ErrMFANotEnrolled      = errors.New("two-factor authentication has not been set up")
+	ErrTOTPCodeReused      = errors.New("authentication code has already been used")
+	ErrRecoveryCodeInvalid = errors.New("recovery code is invalid or already used")
+)
+
+type TOTPState struct {
+	Secret  string
+	Enabled bool
+}
+
+func GetTOTPState(userID int) (*TOTPState, error) {
+	var secret sql.NullString
+	var state TOTPState
+	err := config.DB.QueryRow(`
+		SELECT totp_secret, totp_enabled_at IS NOT NULL FROM users WHERE id = $1`,
+		userID,
+	).Scan(&secret, &state.Enabled)
+	if err != nil {
+		return nil, err
+	}
+	state.Secret = secret.String
+	return &state, nil
+}
+
+// SetPendingTOTPSecret stores a secret that only takes effect once the user
+// proves they can generate codes for it with EnableTOTP.
+func SetPendingTOTPSecret(userID int, secret string) error {
+	result, err := config.DB.Exec(`
+		UPDATE users SET totp_secret = $1, totp_last_step = NULL
+		WHERE id = $2 AND totp_enabled_at IS NULL`,
+		secret, userID,
+	)
+	return requireAffected(result, err, ErrMFAAlreadyEnabled)
+}
+
+func EnableTOTP(userID int, recoveryCodeHashes []string) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE users SET totp_enabled_at = NOW()
+		WHERE id = $1 AND totp_secret IS NOT NULL AND totp_enabled_at IS NULL`,
+		userID,
+	)
+	if err := requireAffected(result, err, ErrMFAAlreadyEnabled); err != nil {
+		return err
+	}
+
+	if err := replaceRecoveryCodes(tx, userID, recoveryCodeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func DisableTOTP(userID int) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE users SET totp_secret = NULL, totp_enabled_at = NULL, totp_last_step = NULL
+		WHERE id = $1`,
+		userID,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// RecordTOTPStep accepts a TOTP time step at most once, so a code that was
+// observed cannot be replayed within its validity window.
+func RecordTOTPStep(userID int, step int64) error {
+	result, err := config.DB.Exec(`
+		UPDATE users SET totp_last_step = $1
+		WHERE id = $2 AND (totp_last_step IS NULL OR totp_last_step < $1)`,
+		step, userID,
+	)
+	return requireAffected(result, err, ErrTOTPCodeReused)
+}
+
+func ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := replaceRecoveryCodes(tx, userID, codeHashes); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func replaceRecoveryCodes(tx *sql.Tx, userID int, codeHashes []string) error {
+	_, err := tx.Exec(`DELETE FROM recovery_codes WHERE user_id = $1`, userID)
+	if err != nil {
+		return err
+	}
+	for _, hash := range codeHashes {
+		_, err = tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash) VALUES ($1, $2)`, userID, hash)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func ConsumeRecoveryCode(userID int, codeHash string) error {
+	result, err := config.DB.Exec(`
+		UPDATE recovery_codes SET used_at = NOW()
+		WHERE user_id = $1 AND code_hash = $2 AND used_at IS NULL`,
+		userID, codeHash,
+	)
+	return requireAffected(result, err, ErrRecoveryCodeInvalid)
+}
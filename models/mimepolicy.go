@@ -0,0 +1,105 @@
+package models
+
+import (
+	"authentication/config"
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrMIMERuleNotFound = errors.New("MIME rule not found")
+
+const (
+	MIMEActionAllow = "allow"
+	MIMEActionDeny  = "deny"
+)
+
+// MIMERule allows or denies uploads whose sniffed type matches Pattern,
+// which is a full type such as "application/pdf", a family such as
+// "image/*", or "*/*".
+type MIMERule struct {
+	ID        int       `json:"id"`
+	Pattern   string    `json:"pattern"`
+	Action    string    `json:"action"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (r MIMERule) Matches(mimeType string) bool {
+	pattern := strings.ToLower(r.Pattern)
+	mimeType = strings.ToLower(mimeType)
+	if pattern == "*/*" || pattern == mimeType {
+		return true
+	}
+	family, ok := strings.CutSuffix(pattern, "/*")
+	return ok && strings.HasPrefix(mimeType, family+"/")
+}
+
+// MIMETypeAllowed applies rules to a sniffed type: any matching deny rule
+// rejects it, and once an allow rule exists only matching types are let
+// through. Without rules everything is allowed.
+func MIMETypeAllowed(rules []MIMERule, mimeType string) bool {
+	allowRules := false
+	allowed := false
+	for _, rule := range rules {
+		switch rule.Action {
+		case MIMEActionDeny:
+			if rule.Matches(mimeType) {
+				return false
+			}
+		case MIMEActionAllow:
+			allowRules = true
+			allowed = allowed || rule.Matches(mimeType)
+		}
+	}
+	return !allowRules || allowed
+}
+
+const mimeRuleColumns = `id, pattern, action, created_at`
+
+func scanMIMERule(row rowScanner) (*MIMERule, error) {
+	var rule MIMERule
+	err := row.Scan(&rule.ID, &rule.Pattern, &rule.Action, &rule.CreatedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrMIMERuleNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &rule, nil
+}
+
+func GetMIMERules() ([]MIMERule, error) {
+	rows, err := config.DB.Query(`SELECT ` + mimeRuleColumns + ` FROM mime_policy_rules ORDER BY pattern`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []MIMERule{}
+	for rows.Next() {
+		rule, err := scanMIMERule(rows)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, *rule)
+	}
+	return rules, rows.Err()
+}
+
+// SaveMIMERule creates a rule, or changes the action of an existing rule
+// for the same pattern.
+func SaveMIMERule(pattern, action string) (*MIMERule, error) {
+	return scanMIMERule(config.DB.QueryRow(`
+		INSERT INTO mime_policy_rules (pattern, action)
+		VALUES ($1, $2)
+		ON CONFLICT (pattern) DO UPDATE SET action = EXCLUDED.action
+		RETURNING `+mimeRuleColumns,
+		pattern, action,
+	))
+}
+
+func DeleteMIMERule(id int) error {
+	result, err := config.DB.Exec(`DELETE FROM mime_policy_rules WHERE id = $1`, id)
+	return requireAffected(result, err, ErrMIMERuleNotFound)
+}
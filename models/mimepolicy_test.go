@@ -0,0 +1,29 @@
+package models
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMIMETypeAllowed(t *testing.T) {
+	assert.True(t, MIMETypeAllowed(nil, "application/x-msdownload"))
+
+	denyExecutables := []MIMERule{
+		{Pattern: "application/x-msdownload", Action: MIMEActionDeny},
+		{Pattern: "application/x-executable", Action: MIMEActionDeny},
+	}
+	assert.False(t, MIMETypeAllowed(denyExecutables, "application/x-msdownload"))
+	assert.True(t, MIMETypeAllowed(denyExecutables, "application/pdf"))
+
+	imagesOnly := []MIMERule{
+		{Pattern: "image/*", Action: MIMEActionAllow},
+		{Pattern: "image/svg+xml", Action: MIMEActionDeny},
+	}
+	assert.True(t, MIMETypeAllowed(imagesOnly, "image/png"))
+	assert.False(t, MIMETypeAllowed(imagesOnly, "image/svg+xml"))
+	assert.False(t, MIMETypeAllowed(imagesOnly, "text/plain"))
+	assert.False(t, MIMETypeAllowed(imagesOnly, "imagex/png"))
+
+	assert.False(t, MIMETypeAllowed([]MIMERule{{Pattern: "*/*", Action: MIMEActionDeny}}, "text/plain"))
+}
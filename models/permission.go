@@ -0,0 +1,152 @@
+package models
+
+import (
+	"authentication/config"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrForbidden = errors.New("insufficient permission for this file")
+
+type Permission string
+
+const (
+	PermissionRead  Permission = "read"
+	PermissionWrite Permission = "write"
+	PermissionOwner Permission = "owner"
+)
+
+var permissionLevels = map[Permission]int{
+	PermissionRead:  1,
+	PermissionWrite: 2,
+	PermissionOwner: 3,
+}
+
+func (p Permission) Valid() bool {
+	return p == PermissionRead || p == PermissionWrite
+}
+
+func (p Permission) Allows(required Permission) bool {
+	return permissionLevels[p] >= permissionLevels[required]
+}
+
+type FileGrant struct {
+	FileID     int        `json:"file_id"`
+	UserID     int        `json:"user_id"`
+	Email      string     `json:"email"`
+	Permission Permission `json:"permission"`
+	GrantedBy  int        `json:"granted_by"`
+	CreatedAt  time.Time  `json:"created_at"`
+}
+
+type SharedFile struct {
+	FileMetadata
+	Permission Permission `json:"permission"`
+}
+
+// GetFileForUser returns the file when userID owns it or holds a grant at
+// least as strong as required. Callers without any access get
+// ErrFileNotFound so the file's existence is not revealed.
+func GetFileForUser(fileID, userID int, required Permission) (*FileMetadata, Permission, error) {
+	file, err := GetFileByID(fileID)
+	if err != nil {
+		return nil, "", ErrFileNotFound
+	}
+	if file.UserID == userID {
+		return file, PermissionOwner, nil
+	}
+
+	var granted Permission
+	err = config.DB.QueryRow(`
+		SELECT permission
+		FROM file_permissions
+		WHERE file_id = $1 AND user_id = $2`,
+		fileID, userID,
+	).Scan(&granted)
+	if err != nil {
+		return nil, "", ErrFileNotFound
+	}
+	if !granted.Allows(required) {
+		return nil, granted, ErrForbidden
+	}
+	return file, granted, nil
+}
+
+func GrantFileAccess(fileID, userID, grantedBy int, permission Permission) error {
+	_, err := config.DB.Exec(`
+		INSERT INTO file_permissions (file_id, user_id, permission, granted_by)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (file_id, user_id) DO UPDATE
+		SET permission = EXCLUDED.permission, granted_by = EXCLUDED.granted_by, created_at = NOW()`,
+		fileID, userID, permission, grantedBy,
+	)
+	return err
+}
+
+func RevokeFileAccess(fileID, userID int) error {
+	result, err := config.DB.Exec(`
+		DELETE FROM file_permissions
+		WHERE file_id = $1 AND user_id = $2`,
+		fileID, userID,
+	)
+	return requireAffected(result, err, ErrFileNotFound)
+}
+
+func GetFileGrants(fileID int) ([]FileGrant, error) {
+	rows, err := config.DB.Query(`
+		SELECT p.file_id, p.user_id, u.email, p.permission, p.granted_by, p.created_at
+		FROM file_permissions p
+		JOIN users u ON u.id = p.user_id
+		WHERE p.file_id = $1
+		ORDER BY u.email`,
+		fileID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying file permissions: %w", err)
+	}
+	defer rows.Close()
+
+	grants := []FileGrant{}
+	for rows.Next() {
+		var grant FileGrant
+		err := rows.Scan(&grant.FileID, &grant.UserID, &grant.Email, &grant.Permission, &grant.GrantedBy, &grant.CreatedAt)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning file permission: %w", err)
+		}
+		grants = append(grants, grant)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over file permissions: %w", err)
+	}
+	return grants, nil
+}
+
+func GetFilesSharedWithUser(userID int) ([]SharedFile, error) {
+	rows, err := config.DB.Query(`
+		SELECT `+fileColumns+`,
+			(SELECT permission FROM file_permissions p WHERE p.file_id = files.id AND p.user_id = $1)
+		FROM files
+		WHERE id IN (SELECT file_id FROM file_permissions WHERE user_id = $1) AND deleted_at IS NULL
+		ORDER BY file_name`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying shared files: %w", err)
+	}
+	defer rows.Close()
+
+	files := []SharedFile{}
+	for rows.Next() {
+		var permission Permission
+		file, err := scanFile(rows, &permission)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning shared file: %w", err)
+		}
+		files = append(files, SharedFile{FileMetadata: *file, Permission: permission})
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over shared files: %w", err)
+	}
+	return files, nil
+}
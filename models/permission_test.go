@@ -0,0 +1,42 @@
+package models
+
+import (
+	"authentication/config"
+	"testing"
+	"time"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetFileForUserChecksGrantLevel(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	for i := 0; i < 2; i++ {
+		mock.ExpectQuery("SELECT (.+) FROM files WHERE id = ").
+			WithArgs(7).
+			WillReturnRows(sqlmock.NewRows([]string{"id", "user_id", "folder_id", "file_name", "file_size", "s3_url", "object_key", "file_extension",
+				"mime_type", "scan_status", "upload_date", "content_sha256", "current_version", "shared_user", "shared_at", "expiry_date", "deleted_at"}).
+				AddRow(7, 1, nil, "notes.txt", 5, "file:///data/1/notes.txt", "1/notes.txt", ".txt", "text/plain", "clean", time.Now(), "", 1, false, nil, nil, nil))
+		mock.ExpectQuery("SELECT permission FROM file_permissions").
+			WithArgs(7, 2).
+			WillReturnRows(sqlmock.NewRows([]string{"permission"}).AddRow("read"))
+	}
+
+	file, permission, err := GetFileForUser(7, 2, PermissionRead)
+	assert.NoError(t, err)
+	assert.Equal(t, PermissionRead, permission)
+	assert.Equal(t, "notes.txt", file.FileName)
+
+	_, _, err = GetFileForUser(7, 2, PermissionWrite)
+	assert.ErrorIs(t, err, ErrForbidden)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,83 @@
+package models
+
+import (
+	"authentication/config"
+	"database/sql"
+	"errors"
+)
+
+var ErrUserNotFound = errors.New("user not found")
+
+type ExtensionUsage struct {
+	Extension string `json:"extension"`
+	Files     int    `json:"files"`
+	Bytes     int64  `json:"bytes"`
+}
+
+type StorageUsage struct {
+	QuotaBytes     int64            `json:"quota_bytes"`
+	UsedBytes      int64            `json:"used_bytes"`
+	AvailableBytes int64            `json:"available_bytes"`
+	FileCount      int              `json:"file_count"`
+	ByExtension    []ExtensionUsage `json:"by_extension,omitempty"`
+}
+
+// GetStorageUsage totals the size of every version of every file the user
+// owns, since old versions are kept in storage too. Trashed files still
+// count until they are purged.
+func GetStorageUsage(userID int) (*StorageUsage, error) {
+	var usage StorageUsage
+	err := config.DB.QueryRow(`
+		SELECT COALESCE(u.quota_bytes, $2),
+			(SELECT COALESCE(SUM(v.file_size), 0) FROM file_versions v JOIN files f ON f.id = v.file_id WHERE f.user_id = u.id),
+			(SELECT COUNT(*) FROM files f WHERE f.user_id = u.id)
+		FROM users u
+		WHERE u.id = $1`,
+		userID, config.DefaultQuotaBytes,
+	).Scan(&usage.QuotaBytes, &usage.UsedBytes, &usage.FileCount)
+	if err == sql.ErrNoRows {
+		return nil, ErrUserNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	usage.AvailableBytes = usage.QuotaBytes - usage.UsedBytes
+	if usage.AvailableBytes < 0 {
+		usage.AvailableBytes = 0
+	}
+	return &usage, nil
+}
+
+func GetUsageByExtension(userID int) ([]ExtensionUsage, error) {
+	rows, err := config.DB.Query(`
+		SELECT LOWER(f.file_extension), COUNT(DISTINCT f.id), SUM(v.file_size)
+		FROM files f
+		JOIN file_versions v ON v.file_id = f.id
+		WHERE f.user_id = $1
+		GROUP BY LOWER(f.file_extension)
+		ORDER BY SUM(v.file_size) DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	usage := []ExtensionUsage{}
+	for rows.Next() {
+		var ext ExtensionUsage
+		if err := rows.Scan(&ext.Extension, &ext.Files, &ext.Bytes); err != nil {
+			return nil, err
+		}
+		usage = append(usage, ext)
+	}
+	return usage, rows.Err()
+}
+
+// SetUserQuota overrides the default quota for a user; an invalid quota
+// restores the default.
+func SetUserQuota(userID int, quota sql.NullInt64) error {
+	result, err := config.DB.Exec("UPDATE users SET quota_bytes = $1 WHERE id = $2", quota, userID)
+	return requireAffected(result, err, ErrUserNotFound)
+}
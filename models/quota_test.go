@@ -0,0 +1,40 @@
+package models
+
+import (
+	"authentication/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetStorageUsage(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	// Every version counts, not just the current one.
+	mock.ExpectQuery("SELECT COALESCE\\(u.quota_bytes, \\$2\\),\\s+\\(SELECT COALESCE\\(SUM\\(v.file_size\\), 0\\) FROM file_versions v").
+		WithArgs(1, config.DefaultQuotaBytes).
+		WillReturnRows(sqlmock.NewRows([]string{"quota_bytes", "used_bytes", "file_count"}).AddRow(100, 40, 3))
+	mock.ExpectQuery("SELECT COALESCE\\(u.quota_bytes, \\$2\\)").
+		WithArgs(2, config.DefaultQuotaBytes).
+		WillReturnRows(sqlmock.NewRows([]string{"quota_bytes", "used_bytes", "file_count"}).AddRow(100, 140, 9))
+
+	usage, err := GetStorageUsage(1)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(60), usage.AvailableBytes)
+	assert.Equal(t, 3, usage.FileCount)
+
+	// A lowered quota can leave a user over the limit.
+	usage, err = GetStorageUsage(2)
+	assert.NoError(t, err)
+	assert.Equal(t, int64(0), usage.AvailableBytes)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,93 @@
+package models
+
+import (
+	"authentication/config"
+)
+
+const (
+	ScanStatusPending  = "pending"
+	ScanStatusClean    = "clean"
+	ScanStatusInfected = "infected"
+)
+
+// GetObjectsPendingScan returns stored objects that at least one file
+// version is waiting to have scanned.
+func GetObjectsPendingScan(limit int) ([]string, error) {
+	rows, err := config.DB.Query(`
+		SELECT object_key
+		FROM file_versions
+		WHERE scan_status = 'pending'
+		GROUP BY object_key
+		ORDER BY MIN(created_at)
+		LIMIT $1`,
+		limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key string
+		if err := rows.Scan(&key); err != nil {
+			return nil, err
+		}
+		keys = append(keys, key)
+	}
+	return keys, rows.Err()
+}
+
+// RecordScanResult stores a verdict on every version using the object and
+// on the files whose current version it is.
+func RecordScanResult(objectKey, status string) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`UPDATE file_versions SET scan_status = $2, scanned_at = NOW() WHERE object_key = $1`, objectKey, status)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE files SET scan_status = $2 WHERE object_key = $1`, objectKey, status)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// QuarantineObject marks the object as infected and points everything that
+// used it at the copy moved to quarantineKey.
+func QuarantineObject(objectKey, quarantineKey, quarantineURL string) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`
+		UPDATE file_versions
+		SET object_key = $2, scan_status = 'infected', scanned_at = NOW()
+		WHERE object_key = $1`,
+		objectKey, quarantineKey,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`
+		UPDATE files
+		SET object_key = $2, s3_url = $3, scan_status = 'infected'
+		WHERE object_key = $1`,
+		objectKey, quarantineKey, quarantineURL,
+	)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE blobs SET object_key = $2 WHERE object_key = $1`, objectKey, quarantineKey)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,149 @@
+package models
+
+import (
+	"authentication/config"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrShareLinkNotFound = errors.New("share link not found or no longer active")
+
+type ShareLink struct {
+	ID            int          `json:"id"`
+	FileID        int          `json:"file_id"`
+	CreatedBy     int          `json:"created_by"`
+	CreatedAt     time.Time    `json:"created_at"`
+	ExpiresAt     sql.NullTime `json:"expires_at"`
+	MaxDownloads  *int         `json:"max_downloads"`
+	DownloadCount int          `json:"download_count"`
+	PasswordHash  string       `json:"-"`
+	HasPassword   bool         `json:"has_password"`
+}
+
+const shareLinkColumns = `id, file_id, created_by, created_at, expires_at, max_downloads, download_count, COALESCE(password_hash, '')`
+
+const activeShareLinkCondition = `revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > NOW())
+		AND (max_downloads IS NULL OR download_count < max_downloads)`
+
+func scanShareLink(row rowScanner) (*ShareLink, error) {
+	var link ShareLink
+	err := row.Scan(&link.ID, &link.FileID, &link.CreatedBy, &link.CreatedAt, &link.ExpiresAt, &link.MaxDownloads, &link.DownloadCount, &link.PasswordHash)
+	if err == sql.ErrNoRows {
+		return nil, ErrShareLinkNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	link.HasPassword = link.PasswordHash != ""
+	return &link, nil
+}
+
+func CreateShareLink(fileID, createdBy int, tokenHash string, expiresAt sql.NullTime, maxDownloads *int, passwordHash string) (*ShareLink, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	link, err := scanShareLink(tx.QueryRow(`
+		INSERT INTO share_links (token_hash, file_id, created_by, expires_at, max_downloads, password_hash)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''))
+		RETURNING `+shareLinkColumns,
+		tokenHash, fileID, createdBy, expiresAt, maxDownloads, passwordHash,
+	))
+	if err != nil {
+		return nil, fmt.Errorf("error saving share link: %w", err)
+	}
+
+	_, err = tx.Exec(`UPDATE files SET shared_user = TRUE, shared_at = NOW() WHERE id = $1`, fileID)
+	if err != nil {
+		return nil, fmt.Errorf("error updating shared status: %w", err)
+	}
+
+	return link, tx.Commit()
+}
+
+func GetActiveShareLink(tokenHash string) (*ShareLink, error) {
+	return scanShareLink(config.DB.QueryRow(`
+		SELECT `+shareLinkColumns+`
+		FROM share_links
+		WHERE token_hash = $1 AND `+activeShareLinkCondition,
+		tokenHash,
+	))
+}
+
+func GetActiveShareLinks(fileID int) ([]ShareLink, error) {
+	rows, err := config.DB.Query(`
+		SELECT `+shareLinkColumns+`
+		FROM share_links
+		WHERE file_id = $1 AND `+activeShareLinkCondition+`
+		ORDER BY created_at DESC`,
+		fileID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying share links: %w", err)
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		link, err := scanShareLink(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning share link: %w", err)
+		}
+		links = append(links, *link)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over share links: %w", err)
+	}
+	return links, nil
+}
+
+func RecordShareLinkDownload(linkID int) error {
+	result, err := config.DB.Exec(`
+		UPDATE share_links
+		SET download_count = download_count + 1
+		WHERE id = $1 AND `+activeShareLinkCondition,
+		linkID,
+	)
+	return requireAffected(result, err, ErrShareLinkNotFound)
+}
+
+func RevokeShareLink(linkID, userID int) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var fileID int
+	err = tx.QueryRow(`
+		UPDATE share_links s
+		SET revoked_at = NOW()
+		FROM files f
+		WHERE s.id = $1 AND s.file_id = f.id AND f.user_id = $2 AND s.revoked_at IS NULL
+		RETURNING s.file_id`,
+		linkID, userID,
+	).Scan(&fileID)
+	if err == sql.ErrNoRows {
+		return ErrShareLinkNotFound
+	}
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		UPDATE files
+		SET shared_user = EXISTS (SELECT 1 FROM share_links WHERE file_id = $1 AND `+activeShareLinkCondition+`)
+		WHERE id = $1`,
+		fileID,
+	)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,58 @@
+package models
+
+import (
+	"authentication/config"
+	"database/sql"
+	"errors"
+	"time"
+)
+
+var ErrTokenInvalid = errors.New("token is invalid, expired or already used")
+
+type TokenPurpose string
+
+const (
+	TokenVerifyEmail   TokenPurpose = "verify_email"
+	TokenResetPassword TokenPurpose = "reset_password"
+)
+
+// CreateUserToken stores a single-use token, replacing any unused token the
+// user already holds for the same purpose.
+func CreateUserToken(userID int, purpose TokenPurpose, tokenHash string, expiresAt time.Time) error {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM user_tokens WHERE user_id = $1 AND purpose = $2 AND used_at IS NULL`, userID, purpose)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO user_tokens (user_id, purpose, token_hash, expires_at)
+		VALUES ($1, $2, $3, $4)`,
+		userID, purpose, tokenHash, expiresAt,
+	)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ConsumeUserToken marks a token as used and returns its user. A token can
+// only be consumed once.
+func ConsumeUserToken(purpose TokenPurpose, tokenHash string) (int, error) {
+	var userID int
+	err := config.DB.QueryRow(`
+		UPDATE user_tokens SET used_at = NOW()
+		WHERE token_hash = $1 AND purpose = $2 AND used_at IS NULL AND expires_at > NOW()
+		RETURNING user_id`,
+		tokenHash, purpose,
+	).Scan(&userID)
+	if err == sql.ErrNoRows {
+		return 0, ErrTokenInvalid
+	}
+	return userID, err
+}
@@ -0,0 +1,54 @@
+package models
+
+import (
+	"authentication/config"
+	"fmt"
+	"time"
+)
+
+func TrashFile(userID, fileID int) error {
+	result, err := config.DB.Exec(`
+		UPDATE files
+		SET deleted_at = NOW()
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NULL`,
+		fileID, userID,
+	)
+	return requireAffected(result, err, ErrFileNotFound)
+}
+
+func GetTrashedFiles(userID int) ([]FileMetadata, error) {
+	rows, err := config.DB.Query(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE user_id = $1 AND deleted_at IS NOT NULL
+		ORDER BY deleted_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying trashed files: %w", err)
+	}
+	return scanFiles(rows)
+}
+
+func RestoreTrashedFile(userID, fileID int) error {
+	result, err := config.DB.Exec(`
+		UPDATE files
+		SET deleted_at = NULL
+		WHERE id = $1 AND user_id = $2 AND deleted_at IS NOT NULL`,
+		fileID, userID,
+	)
+	return requireAffected(result, err, ErrFileNotFound)
+}
+
+func GetFilesTrashedBefore(cutoff time.Time) ([]FileMetadata, error) {
+	rows, err := config.DB.Query(`
+		SELECT `+fileColumns+`
+		FROM files
+		WHERE deleted_at <= $1`,
+		cutoff,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying purgeable files: %w", err)
+	}
+	return scanFiles(rows)
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"authentication/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTrashFileNotFound(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	mock.ExpectExec("UPDATE files SET deleted_at = NOW()").
+		WithArgs(9, 1).
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	err = TrashFile(1, 9)
+
+	assert.ErrorIs(t, err, ErrFileNotFound)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,216 @@
+package models
+
+import (
+	"authentication/config"
+	"authentication/storage"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+var (
+	ErrUploadSessionNotFound = errors.New("upload session not found or expired")
+	ErrUploadOffsetConflict  = errors.New("upload offset does not match")
+)
+
+// UploadSession tracks a resumable upload between chunks. SHA256State holds
+// the marshalled hash of the bytes received so far.
+type UploadSession struct {
+	ID              string
+	UserID          int
+	FileID          *int
+	FolderID        *int
+	FileName        string
+	ContentType     string
+	ExpiryDate      sql.NullTime
+	ObjectKey       string
+	StorageUploadID string
+	Length          int64
+	Offset          int64
+	Parts           []storage.CompletedPart
+	SHA256State     []byte
+	CreatedAt       time.Time
+	ExpiresAt       time.Time
+}
+
+const uploadSessionColumns = `id, user_id, file_id, folder_id, file_name, content_type, expiry_date, object_key,
+	storage_upload_id, upload_length, upload_offset, parts, sha256_state, created_at, expires_at`
+
+func scanUploadSession(row rowScanner) (*UploadSession, error) {
+	var session UploadSession
+	var parts []byte
+	err := row.Scan(&session.ID, &session.UserID, &session.FileID, &session.FolderID, &session.FileName, &session.ContentType,
+		&session.ExpiryDate, &session.ObjectKey, &session.StorageUploadID, &session.Length, &session.Offset, &parts,
+		&session.SHA256State, &session.CreatedAt, &session.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUploadSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(parts, &session.Parts); err != nil {
+		return nil, err
+	}
+	return &session, nil
+}
+
+func CreateUploadSession(session *UploadSession) error {
+	_, err := config.DB.Exec(`
+		INSERT INTO upload_sessions (id, user_id, file_id, folder_id, file_name, content_type, expiry_date, object_key,
+			storage_upload_id, upload_length, sha256_state, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)`,
+		session.ID, session.UserID, session.FileID, session.FolderID, session.FileName, session.ContentType, session.ExpiryDate,
+		session.ObjectKey, session.StorageUploadID, session.Length, session.SHA256State, session.ExpiresAt,
+	)
+	return err
+}
+
+func GetUploadSession(id string, userID int) (*UploadSession, error) {
+	return scanUploadSession(config.DB.QueryRow(`
+		SELECT `+uploadSessionColumns+`
+		FROM upload_sessions
+		WHERE id = $1 AND user_id = $2 AND expires_at > NOW()`,
+		id, userID,
+	))
+}
+
+// AdvanceUploadSession records a stored chunk. It only succeeds if the
+// session is still at fromOffset, so concurrent PATCHes cannot both apply.
+func AdvanceUploadSession(id string, fromOffset, toOffset int64, parts []storage.CompletedPart, sha256State []byte, expiresAt time.Time) error {
+	encoded, err := json.Marshal(parts)
+	if err != nil {
+		return err
+	}
+	result, err := config.DB.Exec(`
+		UPDATE upload_sessions
+		SET upload_offset = $3, parts = $4, sha256_state = $5, expires_at = $6
+		WHERE id = $1 AND upload_offset = $2`,
+		id, fromOffset, toOffset, encoded, sha256State, expiresAt,
+	)
+	return requireAffected(result, err, ErrUploadOffsetConflict)
+}
+
+func DeleteUploadSession(id string) error {
+	_, err := config.DB.Exec(`DELETE FROM upload_sessions WHERE id = $1`, id)
+	return err
+}
+
+func GetExpiredUploadSessions() ([]UploadSession, error) {
+	rows, err := config.DB.Query(`
+		SELECT ` + uploadSessionColumns + `
+		FROM upload_sessions
+		WHERE expires_at <= NOW()`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []UploadSession
+	for rows.Next() {
+		session, err := scanUploadSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, *session)
+	}
+	return sessions, rows.Err()
+}
+
+// PendingUpload is a presigned upload the client has not yet reported as
+// complete. The object may or may not exist in storage.
+type PendingUpload struct {
+	ID          string
+	UserID      int
+	FileID      *int
+	FolderID    *int
+	FileName    string
+	ContentType string
+	ExpiryDate  sql.NullTime
+	ObjectKey   string
+	FileSize    int64
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+const pendingUploadColumns = `id, user_id, file_id, folder_id, file_name, content_type, expiry_date, object_key, file_size, created_at, expires_at`
+
+func scanPendingUpload(row rowScanner) (*PendingUpload, error) {
+	var upload PendingUpload
+	err := row.Scan(&upload.ID, &upload.UserID, &upload.FileID, &upload.FolderID, &upload.FileName, &upload.ContentType,
+		&upload.ExpiryDate, &upload.ObjectKey, &upload.FileSize, &upload.CreatedAt, &upload.ExpiresAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrUploadSessionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &upload, nil
+}
+
+func CreatePendingUpload(upload *PendingUpload) error {
+	_, err := config.DB.Exec(`
+		INSERT INTO pending_uploads (id, user_id, file_id, folder_id, file_name, content_type, expiry_date, object_key, file_size, expires_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10)`,
+		upload.ID, upload.UserID, upload.FileID, upload.FolderID, upload.FileName, upload.ContentType, upload.ExpiryDate,
+		upload.ObjectKey, upload.FileSize, upload.ExpiresAt,
+	)
+	return err
+}
+
+func GetPendingUpload(id string, userID int) (*PendingUpload, error) {
+	return scanPendingUpload(config.DB.QueryRow(`
+		SELECT `+pendingUploadColumns+`
+		FROM pending_uploads
+		WHERE id = $1 AND user_id = $2 AND completed_at IS NULL AND expires_at > NOW()`,
+		id, userID,
+	))
+}
+
+// PendingUploadExists reports whether objectKey is still the target of an
+// unexpired presigned upload that has not been completed.
+func PendingUploadExists(objectKey string) (bool, error) {
+	var exists bool
+	err := config.DB.QueryRow(`
+		SELECT EXISTS(SELECT 1 FROM pending_uploads WHERE object_key = $1 AND completed_at IS NULL AND expires_at > NOW())`,
+		objectKey,
+	).Scan(&exists)
+	return exists, err
+}
+
+// CompletePendingUpload marks an upload as completed, so it can neither be
+// completed again nor written to. The row stays until it expires.
+func CompletePendingUpload(id string) error {
+	result, err := config.DB.Exec(`
+		UPDATE pending_uploads SET completed_at = NOW()
+		WHERE id = $1 AND completed_at IS NULL`,
+		id,
+	)
+	return requireAffected(result, err, ErrUploadSessionNotFound)
+}
+
+func DeletePendingUpload(id string) error {
+	_, err := config.DB.Exec(`DELETE FROM pending_uploads WHERE id = $1`, id)
+	return err
+}
+
+func GetExpiredPendingUploads() ([]PendingUpload, error) {
+	rows, err := config.DB.Query(`
+		SELECT ` + pendingUploadColumns + `
+		FROM pending_uploads
+		WHERE expires_at <= NOW()`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var uploads []PendingUpload
+	for rows.Next() {
+		upload, err := scanPendingUpload(rows)
+		if err != nil {
+			return nil, err
+		}
+		uploads = append(uploads, *upload)
+	}
+	return uploads, rows.Err()
+}
@@ -2,13 +2,16 @@ package models
 
 import (
 	"authentication/config"
+	"database/sql"
 	"fmt"
+	"time"
 )
 
 type User struct {
-	ID       int    `json:"id"`
-	Email    string `json:"email"`
-	Password string `json:"password"`
+	ID         int    `json:"id"`
+	Email      string `json:"email"`
+	Password   string `json:"password"`
+	MFAEnabled bool   `json:"mfa_enabled"`
 }
 
 func UserExists(email string) bool {
@@ -21,9 +24,25 @@ func UserExists(email string) bool {
 	return exists
 }
 
-func CreateUser(email, hashedPassword string) error {
-	_, err := config.DB.Exec("INSERT INTO users (email, password) VALUES ($1, $2)", email, hashedPassword)
-	return err
+func CreateUser(email, hashedPassword string) (int, error) {
+	var userID int
+	err := config.DB.QueryRow("INSERT INTO users (email, password) VALUES ($1, $2) RETURNING id", email, hashedPassword).Scan(&userID)
+	return userID, err
+}
+
+func GetUserIDByEmail(email string) (int, error) {
+	var userID int
+	err := config.DB.QueryRow("SELECT id FROM users WHERE email=$1", email).Scan(&userID)
+	return userID, err
+}
+
+func GetUserByEmail(email string) (*User, error) {
+	var user User
+	err := config.DB.QueryRow("SELECT id, email, password, totp_enabled_at IS NOT NULL FROM users WHERE email=$1", email).Scan(&user.ID, &user.Email, &user.Password, &user.MFAEnabled)
+	if err != nil {
+		return nil, err
+	}
+	return &user, nil
 }
 
 func GetPasswordByEmail(email string) (string, error) {
@@ -31,3 +50,46 @@ func GetPasswordByEmail(email string) (string, error) {
 	err := config.DB.QueryRow("SELECT password FROM users WHERE email=$1", email).Scan(&password)
 	return password, err
 }
+
+func GetDefaultRetention(userID int) (time.Duration, bool, error) {
+	var seconds sql.NullInt64
+	err := config.DB.QueryRow("SELECT default_retention_seconds FROM users WHERE id=$1", userID).Scan(&seconds)
+	if err != nil || !seconds.Valid {
+		return 0, false, err
+	}
+	return time.Duration(seconds.Int64) * time.Second, true, nil
+}
+
+func SetDefaultRetention(userID int, retention time.Duration, enabled bool) error {
+	seconds := sql.NullInt64{Int64: int64(retention / time.Second), Valid: enabled}
+	_, err := config.DB.Exec("UPDATE users SET default_retention_seconds=$1 WHERE id=$2", seconds, userID)
+	return err
+}
+
+func IsEmailVerified(userID int) (bool, error) {
+	var verified bool
+	err := config.DB.QueryRow("SELECT email_verified_at IS NOT NULL FROM users WHERE id=$1", userID).Scan(&verified)
+	return verified, err
+}
+
+func MarkEmailVerified(userID int) error {
+	_, err := config.DB.Exec("UPDATE users SET email_verified_at = COALESCE(email_verified_at, NOW()) WHERE id=$1", userID)
+	return err
+}
+
+func UpdatePassword(userID int, hashedPassword string) error {
+	_, err := config.DB.Exec("UPDATE users SET password=$1 WHERE id=$2", hashedPassword, userID)
+	return err
+}
+
+func GetUserEmailByID(userID int) (string, error) {
+	var email string
+	err := config.DB.QueryRow("SELECT email FROM users WHERE id=$1", userID).Scan(&email)
+	return email, err
+}
+
+func IsAdmin(userID int) (bool, error) {
+	var isAdmin bool
+	err := config.DB.QueryRow("SELECT is_admin FROM users WHERE id=$1", userID).Scan(&isAdmin)
+	return isAdmin, err
+}
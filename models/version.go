@@ -0,0 +1,133 @@
+package models
+
+import (
+	"authentication/config"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+var ErrVersionNotFound = errors.New("file version not found")
+
+type FileVersion struct {
+	ID         int       `json:"id"`
+	FileID     int       `json:"file_id"`
+	Version    int       `json:"version"`
+	ObjectKey  string    `json:"-"`
+	FileSize   int       `json:"file_size"`
+	SHA256     string    `json:"content_sha256"`
+	MimeType   string    `json:"mime_type"`
+	ScanStatus string    `json:"scan_status"`
+	CreatedAt  time.Time `json:"created_at"`
+	Current    bool      `json:"current"`
+}
+
+const versionColumns = `v.id, v.file_id, v.version, v.object_key, v.file_size, v.content_sha256, v.mime_type, v.scan_status, v.created_at, v.version = f.current_version`
+
+func scanVersion(row rowScanner) (*FileVersion, error) {
+	var version FileVersion
+	err := row.Scan(&version.ID, &version.FileID, &version.Version, &version.ObjectKey, &version.FileSize, &version.SHA256, &version.MimeType, &version.ScanStatus, &version.CreatedAt, &version.Current)
+	if err == sql.ErrNoRows {
+		return nil, ErrVersionNotFound
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &version, nil
+}
+
+func GetFileVersions(fileID int) ([]FileVersion, error) {
+	rows, err := config.DB.Query(`
+		SELECT `+versionColumns+`
+		FROM file_versions v
+		JOIN files f ON f.id = v.file_id
+		WHERE v.file_id = $1
+		ORDER BY v.version DESC`,
+		fileID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("error querying file versions: %w", err)
+	}
+	defer rows.Close()
+
+	var versions []FileVersion
+	for rows.Next() {
+		version, err := scanVersion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("error scanning file version: %w", err)
+		}
+		versions = append(versions, *version)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over file versions: %w", err)
+	}
+	return versions, nil
+}
+
+func GetFileVersion(fileID, version int) (*FileVersion, error) {
+	row := config.DB.QueryRow(`
+		SELECT `+versionColumns+`
+		FROM file_versions v
+		JOIN files f ON f.id = v.file_id
+		WHERE v.file_id = $1 AND v.version = $2`,
+		fileID, version,
+	)
+	return scanVersion(row)
+}
+
+func AddFileVersion(fileID int, objectKey, fileURL string, fileSize int, contentSHA256, mimeType string) (int, error) {
+	tx, err := config.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	err = tx.QueryRow(`SELECT id FROM files WHERE id = $1 FOR UPDATE`, fileID).Scan(&fileID)
+	if err == sql.ErrNoRows {
+		return 0, ErrFileNotFound
+	}
+	if err != nil {
+		return 0, fmt.Errorf("error locking file: %w", err)
+	}
+
+	var version int
+	err = tx.QueryRow(`SELECT COALESCE(MAX(version), 0) + 1 FROM file_versions WHERE file_id = $1`, fileID).Scan(&version)
+	if err != nil {
+		return 0, fmt.Errorf("error determining next version: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO file_versions (file_id, version, object_key, file_size, content_sha256, mime_type, scan_status)
+		VALUES ($1, $2, $3, $4, $5, $6, 'pending')`,
+		fileID, version, objectKey, fileSize, contentSHA256, mimeType,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error saving file version: %w", err)
+	}
+
+	_, err = tx.Exec(`
+		UPDATE files
+		SET object_key = $1, s3_url = $2, file_size = $3, content_sha256 = $4, mime_type = $5, scan_status = 'pending',
+			current_version = $6, upload_date = NOW()
+		WHERE id = $7`,
+		objectKey, fileURL, fileSize, contentSHA256, mimeType, version, fileID,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("error updating current version: %w", err)
+	}
+
+	return version, tx.Commit()
+}
+
+func RestoreFileVersion(fileID, version int, fileURL string) error {
+	result, err := config.DB.Exec(`
+		UPDATE files f
+		SET object_key = v.object_key, s3_url = $1, file_size = v.file_size, content_sha256 = v.content_sha256, mime_type = v.mime_type,
+			scan_status = v.scan_status, current_version = v.version, upload_date = NOW()
+		FROM file_versions v
+		WHERE f.id = $2 AND v.file_id = f.id AND v.version = $3`,
+		fileURL, fileID, version,
+	)
+	return requireAffected(result, err, ErrVersionNotFound)
+}
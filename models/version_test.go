@@ -0,0 +1,42 @@
+package models
+
+import (
+	"authentication/config"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddFileVersion(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	mock.ExpectBegin()
+	mock.ExpectQuery("SELECT id FROM files WHERE id = (.+) FOR UPDATE").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(3))
+	mock.ExpectQuery("SELECT COALESCE\\(MAX\\(version\\), 0\\) \\+ 1 FROM file_versions").
+		WithArgs(3).
+		WillReturnRows(sqlmock.NewRows([]string{"version"}).AddRow(4))
+	mock.ExpectExec("INSERT INTO file_versions").
+		WithArgs(3, 4, "1/new.txt", 20, "abc", "text/plain").
+		WillReturnResult(sqlmock.NewResult(1, 1))
+	mock.ExpectExec("UPDATE files").
+		WithArgs("1/new.txt", "file:///data/1/new.txt", 20, "abc", "text/plain", 4, 3).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	version, err := AddFileVersion(3, "1/new.txt", "file:///data/1/new.txt", 20, "abc", "text/plain")
+
+	assert.NoError(t, err)
+	assert.Equal(t, 4, version)
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
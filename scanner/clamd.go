@@ -0,0 +1,120 @@
+package scanner
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+)
+
+const (
+	clamdChunkSize = 64 << 10
+	// clamdIOTimeout bounds each read or write on the connection rather than
+	// the whole scan, since large files take a while to stream.
+	clamdIOTimeout = time.Minute
+)
+
+// ClamdScanner streams content to a ClamAV daemon with the INSTREAM command.
+type ClamdScanner struct {
+	network string
+	addr    string
+}
+
+// NewClamdScanner connects to clamd at addr, either host:port or the path of
+// its Unix socket.
+func NewClamdScanner(addr string) *ClamdScanner {
+	if strings.HasPrefix(addr, "/") {
+		return &ClamdScanner{network: "unix", addr: addr}
+	}
+	return &ClamdScanner{network: "tcp", addr: addr}
+}
+
+func (s *ClamdScanner) Scan(ctx context.Context, content io.Reader) (*Result, error) {
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, s.network, s.addr)
+	if err != nil {
+		return nil, fmt.Errorf("error connecting to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	connFailed, err := s.stream(conn, content)
+	if err != nil {
+		// clamd replies before closing the connection when it rejects a
+		// stream, for example one exceeding StreamMaxLength.
+		if connFailed {
+			if reply, replyErr := readClamdReply(conn); replyErr == nil {
+				return parseClamdReply(reply)
+			}
+		}
+		return nil, err
+	}
+
+	reply, err := readClamdReply(conn)
+	if err != nil {
+		return nil, err
+	}
+	return parseClamdReply(reply)
+}
+
+// stream sends content as INSTREAM chunks, each prefixed with its length,
+// and reports whether a failure came from the connection rather than from
+// reading content.
+func (s *ClamdScanner) stream(conn net.Conn, content io.Reader) (bool, error) {
+	conn.SetWriteDeadline(time.Now().Add(clamdIOTimeout))
+	if _, err := io.WriteString(conn, "zINSTREAM\x00"); err != nil {
+		return true, fmt.Errorf("error sending command to clamd: %w", err)
+	}
+
+	buf := make([]byte, 4+clamdChunkSize)
+	for {
+		n, err := io.ReadFull(content, buf[4:])
+		if n > 0 {
+			binary.BigEndian.PutUint32(buf[:4], uint32(n))
+			conn.SetWriteDeadline(time.Now().Add(clamdIOTimeout))
+			if _, err := conn.Write(buf[:4+n]); err != nil {
+				return true, fmt.Errorf("error streaming to clamd: %w", err)
+			}
+		}
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			break
+		}
+		if err != nil {
+			return false, err
+		}
+	}
+
+	conn.SetWriteDeadline(time.Now().Add(clamdIOTimeout))
+	if _, err := conn.Write([]byte{0, 0, 0, 0}); err != nil {
+		return true, fmt.Errorf("error streaming to clamd: %w", err)
+	}
+	return false, nil
+}
+
+func readClamdReply(conn net.Conn) (string, error) {
+	conn.SetReadDeadline(time.Now().Add(clamdIOTimeout))
+	reply, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && reply == "" {
+		return "", fmt.Errorf("error reading clamd reply: %w", err)
+	}
+	return reply, nil
+}
+
+// parseClamdReply understands "stream: OK", "stream: <signature> FOUND" and
+// "<message> ERROR".
+func parseClamdReply(reply string) (*Result, error) {
+	reply = strings.TrimSpace(strings.TrimSuffix(reply, "\x00"))
+	reply = strings.TrimPrefix(reply, "stream: ")
+
+	switch {
+	case reply == "OK":
+		return &Result{}, nil
+	case strings.HasSuffix(reply, " FOUND"):
+		return &Result{Infected: true, Signature: strings.TrimSuffix(reply, " FOUND")}, nil
+	default:
+		return nil, fmt.Errorf("clamd: %s", strings.TrimSuffix(reply, " ERROR"))
+	}
+}
@@ -0,0 +1,92 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fakeClamd accepts one INSTREAM scan per connection and reports content
+// containing the EICAR test file as infected.
+func fakeClamd(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("failed to listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func(conn net.Conn) {
+				defer conn.Close()
+
+				command := make([]byte, len("zINSTREAM\x00"))
+				if _, err := io.ReadFull(conn, command); err != nil || string(command) != "zINSTREAM\x00" {
+					io.WriteString(conn, "UNKNOWN COMMAND\x00")
+					return
+				}
+
+				var content bytes.Buffer
+				for {
+					var size uint32
+					if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+						return
+					}
+					if size == 0 {
+						break
+					}
+					if _, err := io.CopyN(&content, conn, int64(size)); err != nil {
+						return
+					}
+				}
+
+				if bytes.Contains(content.Bytes(), []byte(EICARSignature)) {
+					io.WriteString(conn, "stream: Eicar-Test-Signature FOUND\x00")
+				} else {
+					io.WriteString(conn, "stream: OK\x00")
+				}
+			}(conn)
+		}
+	}()
+
+	return listener.Addr().String()
+}
+
+func TestClamdScanner(t *testing.T) {
+	scanner := NewClamdScanner(fakeClamd(t))
+	ctx := context.Background()
+
+	result, err := scanner.Scan(ctx, strings.NewReader(strings.Repeat("hello world ", 20000)))
+	assert.NoError(t, err)
+	assert.False(t, result.Infected)
+
+	result, err = scanner.Scan(ctx, strings.NewReader("prefix "+EICARSignature))
+	assert.NoError(t, err)
+	assert.True(t, result.Infected)
+	assert.Equal(t, "Eicar-Test-Signature", result.Signature)
+}
+
+func TestParseClamdReply(t *testing.T) {
+	_, err := parseClamdReply("INSTREAM size limit exceeded. ERROR\x00")
+	assert.EqualError(t, err, "clamd: INSTREAM size limit exceeded.")
+}
+
+func TestStubScanner(t *testing.T) {
+	result, err := NewStubScanner().Scan(context.Background(), strings.NewReader(EICARSignature))
+	assert.NoError(t, err)
+	assert.True(t, result.Infected)
+
+	result, err = NewStubScanner().Scan(context.Background(), strings.NewReader("hello world"))
+	assert.NoError(t, err)
+	assert.False(t, result.Infected)
+}
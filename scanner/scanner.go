@@ -0,0 +1,17 @@
+package scanner
+
+import (
+	"context"
+	"io"
+)
+
+// Result is the verdict on one piece of content. Signature names the
+// malware found, if any.
+type Result struct {
+	Infected  bool
+	Signature string
+}
+
+type Scanner interface {
+	Scan(ctx context.Context, content io.Reader) (*Result, error)
+}
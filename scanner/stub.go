@@ -0,0 +1,30 @@
+package scanner
+
+import (
+	"bytes"
+	"context"
+	"io"
+)
+
+// EICARSignature is the standard antivirus test file, which every scanner
+// reports as infected.
+const EICARSignature = `X5O!P%@AP[4\PZX54(P^)7CC)7}$EICAR-STANDARD-ANTIVIRUS-TEST-FILE!$H+H*`
+
+// StubScanner flags content containing the EICAR test file and passes
+// everything else, so that scanning can be exercised without a clamd daemon.
+type StubScanner struct{}
+
+func NewStubScanner() *StubScanner {
+	return &StubScanner{}
+}
+
+func (s *StubScanner) Scan(ctx context.Context, content io.Reader) (*Result, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.Contains(data, []byte(EICARSignature)) {
+		return &Result{Infected: true, Signature: "Eicar-Test-Signature"}, nil
+	}
+	return &Result{}, nil
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"crypto/rand"
+	"fmt"
+	"path"
+	"strings"
+)
+
+const maxKeyExtensionLength = 16
+
+// NewObjectKey returns a collision-free key of the form
+// "<userID>/<uuid><ext>", keeping the original extension only when it is made
+// of safe characters.
+func NewObjectKey(userID int, fileName string) (string, error) {
+	id, err := newUUID()
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%d/%s%s", userID, id, safeExtension(fileName)), nil
+}
+
+func newUUID() (string, error) {
+	var b [16]byte
+	if _, err := rand.Read(b[:]); err != nil {
+		return "", fmt.Errorf("error generating object key: %w", err)
+	}
+	b[6] = (b[6] & 0x0f) | 0x40
+	b[8] = (b[8] & 0x3f) | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]), nil
+}
+
+func safeExtension(fileName string) string {
+	ext := strings.ToLower(path.Ext(fileName))
+	if len(ext) < 2 || len(ext) > maxKeyExtensionLength {
+		return ""
+	}
+	for _, c := range ext[1:] {
+		if (c < 'a' || c > 'z') && (c < '0' || c > '9') {
+			return ""
+		}
+	}
+	return ext
+}
@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewObjectKey(t *testing.T) {
+	first, err := NewObjectKey(42, "Report.PDF")
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^42/[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}\.pdf$`), first)
+
+	second, err := NewObjectKey(42, "Report.PDF")
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	unsafe, err := NewObjectKey(42, "archive.t%2F..")
+	assert.NoError(t, err)
+	assert.Regexp(t, regexp.MustCompile(`^42/[0-9a-f-]{36}$`), unsafe)
+}
@@ -0,0 +1,446 @@
+package storage
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/md5"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type LocalBackend struct {
+	root string
+
+	signedURLBase string
+	signingKey    []byte
+}
+
+func NewLocalBackend(root string) (*LocalBackend, error) {
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return nil, fmt.Errorf("error resolving storage root: %w", err)
+	}
+	if err := os.MkdirAll(absRoot, 0o755); err != nil {
+		return nil, fmt.Errorf("error creating storage root: %w", err)
+	}
+	return &LocalBackend{root: absRoot}, nil
+}
+
+func (b *LocalBackend) objectPath(key string) (string, error) {
+	cleaned := path.Clean("/" + key)
+	if key == "" || cleaned == "/" || cleaned[1:] != key {
+		return "", fmt.Errorf("invalid object key %q", key)
+	}
+	return filepath.Join(b.root, filepath.FromSlash(key)), nil
+}
+
+func (b *LocalBackend) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	objectPath, err := b.objectPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(objectPath), 0o755); err != nil {
+		return fmt.Errorf("error creating object directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(objectPath), ".upload-*")
+	if err != nil {
+		return fmt.Errorf("error creating temporary object: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return fmt.Errorf("error writing object: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("error writing object: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp.Name(), objectPath); err != nil {
+		return fmt.Errorf("error storing object: %w", err)
+	}
+	return nil
+}
+
+func (b *LocalBackend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	objectPath, err := b.objectPath(key)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	f, err := os.Open(objectPath)
+	if err != nil {
+		return nil, nil, wrapFSError("error opening object", err)
+	}
+	stat, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, wrapFSError("error reading object metadata", err)
+	}
+	return f, fileInfo(key, stat), nil
+}
+
+func (b *LocalBackend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	objectPath, err := b.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+
+	f, err := os.Open(objectPath)
+	if err != nil {
+		return nil, wrapFSError("error opening object", err)
+	}
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("error seeking object: %w", err)
+	}
+	if length < 0 {
+		return f, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(f, length), f}, nil
+}
+
+func (b *LocalBackend) Delete(ctx context.Context, key string) error {
+	objectPath, err := b.objectPath(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(objectPath); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("error deleting object: %w", err)
+	}
+	return nil
+}
+
+// Copy links the copy to the same file where the filesystem allows it,
+// which is safe because objects are only ever replaced by renaming over
+// them. Content types are not stored locally, so contentType is ignored.
+func (b *LocalBackend) Copy(ctx context.Context, srcKey, dstKey, contentType string) error {
+	srcPath, err := b.objectPath(srcKey)
+	if err != nil {
+		return err
+	}
+	dstPath, err := b.objectPath(dstKey)
+	if err != nil {
+		return err
+	}
+	if srcPath == dstPath {
+		_, err := b.Stat(ctx, srcKey)
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(dstPath), 0o755); err != nil {
+		return fmt.Errorf("error creating object directory: %w", err)
+	}
+
+	err = os.Link(srcPath, dstPath)
+	if err == nil {
+		return nil
+	}
+	if errors.Is(err, fs.ErrNotExist) {
+		return wrapFSError("error copying object", err)
+	}
+
+	body, _, err := b.Get(ctx, srcKey)
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+	return b.Put(ctx, dstKey, body, contentType)
+}
+
+func (b *LocalBackend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	objectPath, err := b.objectPath(key)
+	if err != nil {
+		return nil, err
+	}
+	stat, err := os.Stat(objectPath)
+	if err != nil {
+		return nil, wrapFSError("error reading object metadata", err)
+	}
+	return fileInfo(key, stat), nil
+}
+
+func (b *LocalBackend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := filepath.WalkDir(b.root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && p == filepath.Join(b.root, multipartDir) {
+			return fs.SkipDir
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".upload-") {
+			return nil
+		}
+
+		rel, err := filepath.Rel(b.root, p)
+		if err != nil {
+			return err
+		}
+		key := filepath.ToSlash(rel)
+		if !strings.HasPrefix(key, prefix) {
+			return nil
+		}
+
+		stat, err := d.Info()
+		if err != nil {
+			return err
+		}
+		objects = append(objects, *fileInfo(key, stat))
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects: %w", err)
+	}
+	return objects, nil
+}
+
+func (b *LocalBackend) URL(key string) string {
+	u := url.URL{Scheme: "file", Path: filepath.ToSlash(filepath.Join(b.root, filepath.FromSlash(key)))}
+	return u.String()
+}
+
+// Parts of in-progress multipart uploads live under multipartDir, which
+// cannot collide with object keys because those never start with a dot.
+const multipartDir = ".multipart"
+
+func (b *LocalBackend) MinPartSize() int64 {
+	return 1
+}
+
+func (b *LocalBackend) multipartPath(uploadID string) (string, error) {
+	if uploadID == "" || strings.Trim(uploadID, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid upload ID %q", uploadID)
+	}
+	return filepath.Join(b.root, multipartDir, uploadID), nil
+}
+
+// partFileName names a part by its number and ETag, so a part uploaded
+// again with different content never replaces the one already recorded.
+func partFileName(number int, etag string) (string, error) {
+	if len(etag) != 2*md5.Size || strings.Trim(etag, "0123456789abcdef") != "" {
+		return "", fmt.Errorf("invalid ETag %q for part %d", etag, number)
+	}
+	return fmt.Sprintf("%05d-%s", number, etag), nil
+}
+
+func (b *LocalBackend) CreateMultipart(ctx context.Context, key, contentType string) (string, error) {
+	if _, err := b.objectPath(key); err != nil {
+		return "", err
+	}
+	id := make([]byte, 16)
+	if _, err := rand.Read(id); err != nil {
+		return "", fmt.Errorf("error generating upload ID: %w", err)
+	}
+	uploadID := hex.EncodeToString(id)
+
+	dir, _ := b.multipartPath(uploadID)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", fmt.Errorf("error creating multipart upload: %w", err)
+	}
+	return uploadID, nil
+}
+
+func (b *LocalBackend) UploadPart(ctx context.Context, key, uploadID string, number int, body io.ReadSeeker, size int64) (string, error) {
+	dir, err := b.multipartPath(uploadID)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(dir); err != nil {
+		return "", wrapFSError("error opening multipart upload", err)
+	}
+
+	tmp, err := os.CreateTemp(dir, ".upload-*")
+	if err != nil {
+		return "", fmt.Errorf("error creating part: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	hasher := md5.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hasher), body)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", fmt.Errorf("error writing part: %w", err)
+	}
+	if written != size {
+		return "", fmt.Errorf("error writing part: got %d bytes, expected %d", written, size)
+	}
+	etag := hex.EncodeToString(hasher.Sum(nil))
+	name, err := partFileName(number, etag)
+	if err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), filepath.Join(dir, name)); err != nil {
+		return "", fmt.Errorf("error storing part: %w", err)
+	}
+	return etag, nil
+}
+
+func (b *LocalBackend) CompleteMultipart(ctx context.Context, key, uploadID string, parts []CompletedPart) error {
+	dir, err := b.multipartPath(uploadID)
+	if err != nil {
+		return err
+	}
+
+	files := make([]*os.File, 0, len(parts))
+	closeAll := func() {
+		for _, f := range files {
+			f.Close()
+		}
+	}
+	readers := make([]io.Reader, 0, len(parts))
+	for _, part := range parts {
+		name, err := partFileName(part.Number, part.ETag)
+		if err != nil {
+			closeAll()
+			return err
+		}
+		f, err := os.Open(filepath.Join(dir, name))
+		if err != nil {
+			closeAll()
+			return wrapFSError("error opening part", err)
+		}
+		files = append(files, f)
+		readers = append(readers, f)
+	}
+
+	err = b.Put(ctx, key, io.MultiReader(readers...), "")
+	closeAll()
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func (b *LocalBackend) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	dir, err := b.multipartPath(uploadID)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+func fileInfo(key string, stat fs.FileInfo) *ObjectInfo {
+	contentType := mime.TypeByExtension(path.Ext(key))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	return &ObjectInfo{
+		Key:          key,
+		Size:         stat.Size(),
+		LastModified: stat.ModTime(),
+		ContentType:  contentType,
+	}
+}
+
+func wrapFSError(msg string, err error) error {
+	if errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("%s: %w", msg, ErrNotFound)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// SignedRequest holds the parameters bound into a signed URL.
+type SignedRequest struct {
+	Key         string
+	Size        int64
+	ContentType string
+	FileName    string
+}
+
+// EnableSignedURLs lets the backend emulate presigned URLs. They point at
+// baseURL followed by the object key and carry an HMAC of the method, key,
+// expiry and request parameters, which VerifySignedURL checks when the
+// request reaches the server.
+func (b *LocalBackend) EnableSignedURLs(baseURL string, key []byte) {
+	b.signedURLBase = strings.TrimSuffix(baseURL, "/")
+	b.signingKey = key
+}
+
+func (b *LocalBackend) signature(method string, expires int64, req SignedRequest) string {
+	mac := hmac.New(sha256.New, b.signingKey)
+	fmt.Fprintf(mac, "%s\n%s\n%d\n%d\n%s\n%s", method, req.Key, expires, req.Size, req.ContentType, req.FileName)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func (b *LocalBackend) signURL(method string, req SignedRequest, ttl time.Duration) (string, error) {
+	if b.signingKey == nil {
+		return "", errors.New("signed URLs are not enabled for local storage")
+	}
+	if _, err := b.objectPath(req.Key); err != nil {
+		return "", err
+	}
+
+	expires := time.Now().Add(ttl).Unix()
+	query := url.Values{}
+	query.Set("expires", strconv.FormatInt(expires, 10))
+	query.Set("content_type", req.ContentType)
+	if method == http.MethodPut {
+		query.Set("size", strconv.FormatInt(req.Size, 10))
+	} else {
+		query.Set("filename", req.FileName)
+	}
+	query.Set("signature", b.signature(method, expires, req))
+
+	return b.signedURLBase + (&url.URL{Path: "/" + req.Key}).EscapedPath() + "?" + query.Encode(), nil
+}
+
+func (b *LocalBackend) PresignPut(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (string, error) {
+	return b.signURL(http.MethodPut, SignedRequest{Key: key, Size: size, ContentType: contentType}, ttl)
+}
+
+func (b *LocalBackend) PresignGet(ctx context.Context, key, fileName, contentType string, ttl time.Duration) (string, error) {
+	return b.signURL(http.MethodGet, SignedRequest{Key: key, FileName: fileName, ContentType: contentType}, ttl)
+}
+
+// VerifySignedURL checks a request against a URL issued by PresignPut or
+// PresignGet and returns the parameters it was signed with. HEAD requests
+// are accepted on GET URLs.
+func (b *LocalBackend) VerifySignedURL(method, key string, query url.Values) (*SignedRequest, error) {
+	if b.signingKey == nil {
+		return nil, ErrInvalidSignature
+	}
+	if method == http.MethodHead {
+		method = http.MethodGet
+	}
+
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || time.Now().Unix() > expires {
+		return nil, ErrInvalidSignature
+	}
+
+	req := SignedRequest{Key: key, ContentType: query.Get("content_type"), FileName: query.Get("filename")}
+	if method == http.MethodPut {
+		req.Size, err = strconv.ParseInt(query.Get("size"), 10, 64)
+		if err != nil {
+			return nil, ErrInvalidSignature
+		}
+	}
+
+	expected := b.signature(method, expires, req)
+	if !hmac.Equal([]byte(expected), []byte(query.Get("signature"))) {
+		return nil, ErrInvalidSignature
+	}
+	return &req, nil
+}
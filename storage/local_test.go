@@ -0,0 +1,179 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLocalBackendRoundTrip(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local backend: %v", err)
+	}
+	ctx := context.Background()
+
+	err = backend.Put(ctx, "1/report.txt", strings.NewReader("hello world"), "text/plain")
+	assert.NoError(t, err)
+
+	info, err := backend.Stat(ctx, "1/report.txt")
+	assert.NoError(t, err)
+	assert.Equal(t, int64(11), info.Size)
+
+	body, _, err := backend.Get(ctx, "1/report.txt")
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "hello world", string(data))
+
+	objects, err := backend.List(ctx, "1/")
+	assert.NoError(t, err)
+	assert.Len(t, objects, 1)
+	assert.Equal(t, "1/report.txt", objects[0].Key)
+
+	assert.NoError(t, backend.Delete(ctx, "1/report.txt"))
+	_, err = backend.Stat(ctx, "1/report.txt")
+	assert.True(t, errors.Is(err, ErrNotFound))
+}
+
+func TestLocalBackendCopy(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local backend: %v", err)
+	}
+	ctx := context.Background()
+
+	assert.NoError(t, backend.Put(ctx, "1/staged.txt", strings.NewReader("hello world"), "text/plain"))
+	assert.NoError(t, backend.Copy(ctx, "1/staged.txt", "2/copy.txt", ""))
+	assert.NoError(t, backend.Copy(ctx, "2/copy.txt", "2/copy.txt", "text/plain"))
+
+	// Replacing or deleting the source leaves the copy untouched.
+	assert.NoError(t, backend.Put(ctx, "1/staged.txt", strings.NewReader("HELLO WORLD"), "text/plain"))
+	assert.NoError(t, backend.Delete(ctx, "1/staged.txt"))
+
+	body, _, err := backend.Get(ctx, "2/copy.txt")
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "hello world", string(data))
+
+	assert.True(t, errors.Is(backend.Copy(ctx, "1/staged.txt", "2/other.txt", ""), ErrNotFound))
+	assert.Error(t, backend.Copy(ctx, "2/copy.txt", "../escape.txt", ""))
+}
+
+func TestLocalBackendRejectsTraversal(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local backend: %v", err)
+	}
+
+	err = backend.Put(context.Background(), "../escape.txt", strings.NewReader("x"), "")
+	assert.Error(t, err)
+}
+
+func TestLocalBackendMultipart(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local backend: %v", err)
+	}
+	ctx := context.Background()
+
+	uploadID, err := backend.CreateMultipart(ctx, "1/recording.wav", "audio/wav")
+	assert.NoError(t, err)
+
+	var parts []CompletedPart
+	for i, chunk := range []string{"hello ", "world"} {
+		etag, err := backend.UploadPart(ctx, "1/recording.wav", uploadID, i+1, strings.NewReader(chunk), int64(len(chunk)))
+		assert.NoError(t, err)
+		parts = append(parts, CompletedPart{Number: i + 1, ETag: etag})
+	}
+
+	// Uploading a part again must not change the content of the ETag
+	// already recorded for it.
+	_, err = backend.UploadPart(ctx, "1/recording.wav", uploadID, 2, strings.NewReader("WORLD"), 5)
+	assert.NoError(t, err)
+
+	objects, err := backend.List(ctx, "")
+	assert.NoError(t, err)
+	assert.Empty(t, objects)
+
+	assert.NoError(t, backend.CompleteMultipart(ctx, "1/recording.wav", uploadID, parts))
+
+	body, _, err := backend.Get(ctx, "1/recording.wav")
+	assert.NoError(t, err)
+	data, _ := io.ReadAll(body)
+	body.Close()
+	assert.Equal(t, "hello world", string(data))
+
+	_, err = backend.UploadPart(ctx, "1/recording.wav", uploadID, 3, strings.NewReader("x"), 1)
+	assert.True(t, errors.Is(err, ErrNotFound))
+
+	uploadID, err = backend.CreateMultipart(ctx, "1/other.wav", "audio/wav")
+	assert.NoError(t, err)
+	_, err = backend.UploadPart(ctx, "1/other.wav", uploadID, 1, strings.NewReader("x"), 1)
+	assert.NoError(t, err)
+	assert.True(t, errors.Is(backend.CompleteMultipart(ctx, "1/other.wav", uploadID, []CompletedPart{{Number: 1, ETag: strings.Repeat("0", 32)}}), ErrNotFound))
+	assert.Error(t, backend.CompleteMultipart(ctx, "1/other.wav", uploadID, []CompletedPart{{Number: 1, ETag: "../../etc"}}))
+
+	_, err = backend.UploadPart(ctx, "1/recording.wav", "../../etc", 1, strings.NewReader("x"), 1)
+	assert.Error(t, err)
+}
+
+func TestLocalBackendSignedURLs(t *testing.T) {
+	backend, err := NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local backend: %v", err)
+	}
+	ctx := context.Background()
+
+	_, err = backend.PresignPut(ctx, "1/report.txt", "text/plain", 11, time.Minute)
+	assert.Error(t, err, "signing must be enabled first")
+
+	backend.EnableSignedURLs("http://localhost:8080/storage/local/", []byte("secret"))
+
+	putURL, err := backend.PresignPut(ctx, "1/report.txt", "text/plain", 11, time.Minute)
+	assert.NoError(t, err)
+	parsed, err := url.Parse(putURL)
+	assert.NoError(t, err)
+	assert.Equal(t, "/storage/local/1/report.txt", parsed.Path)
+
+	signed, err := backend.VerifySignedURL(http.MethodPut, "1/report.txt", parsed.Query())
+	assert.NoError(t, err)
+	assert.Equal(t, &SignedRequest{Key: "1/report.txt", Size: 11, ContentType: "text/plain"}, signed)
+
+	_, err = backend.VerifySignedURL(http.MethodPut, "1/other.txt", parsed.Query())
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+	_, err = backend.VerifySignedURL(http.MethodGet, "1/report.txt", parsed.Query())
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	tampered := parsed.Query()
+	tampered.Set("size", "1000")
+	_, err = backend.VerifySignedURL(http.MethodPut, "1/report.txt", tampered)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	getURL, err := backend.PresignGet(ctx, "1/report.txt", "report.txt", "text/plain", time.Minute)
+	assert.NoError(t, err)
+	parsed, _ = url.Parse(getURL)
+	signed, err = backend.VerifySignedURL(http.MethodHead, "1/report.txt", parsed.Query())
+	assert.NoError(t, err)
+	assert.Equal(t, "report.txt", signed.FileName)
+	assert.Equal(t, "text/plain", signed.ContentType)
+
+	tampered = parsed.Query()
+	tampered.Set("content_type", "text/html")
+	_, err = backend.VerifySignedURL(http.MethodGet, "1/report.txt", tampered)
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+
+	expired, err := backend.PresignGet(ctx, "1/report.txt", "report.txt", "", -time.Minute)
+	assert.NoError(t, err)
+	parsed, _ = url.Parse(expired)
+	_, err = backend.VerifySignedURL(http.MethodGet, "1/report.txt", parsed.Query())
+	assert.ErrorIs(t, err, ErrInvalidSignature)
+}
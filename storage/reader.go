@@ -0,0 +1,72 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ObjectReader exposes a stored object as an io.ReadSeeker, fetching only the
+// byte ranges that are actually read so http.ServeContent can serve partial
+// content without downloading the whole object first.
+type ObjectReader struct {
+	ctx     context.Context
+	backend Backend
+	key     string
+	size    int64
+	offset  int64
+	body    io.ReadCloser
+}
+
+func NewObjectReader(ctx context.Context, backend Backend, key string, size int64) *ObjectReader {
+	return &ObjectReader{ctx: ctx, backend: backend, key: key, size: size}
+}
+
+func (r *ObjectReader) Read(p []byte) (int, error) {
+	if r.offset >= r.size {
+		return 0, io.EOF
+	}
+	if r.body == nil {
+		body, err := r.backend.GetRange(r.ctx, r.key, r.offset, -1)
+		if err != nil {
+			return 0, err
+		}
+		r.body = body
+	}
+
+	n, err := r.body.Read(p)
+	r.offset += int64(n)
+	return n, err
+}
+
+func (r *ObjectReader) Seek(offset int64, whence int) (int64, error) {
+	var next int64
+	switch whence {
+	case io.SeekStart:
+		next = offset
+	case io.SeekCurrent:
+		next = r.offset + offset
+	case io.SeekEnd:
+		next = r.size + offset
+	default:
+		return 0, errors.New("invalid whence")
+	}
+	if next < 0 {
+		return 0, errors.New("negative position")
+	}
+
+	if next != r.offset {
+		r.Close()
+		r.offset = next
+	}
+	return next, nil
+}
+
+func (r *ObjectReader) Close() error {
+	if r.body == nil {
+		return nil
+	}
+	err := r.body.Close()
+	r.body = nil
+	return err
+}
@@ -0,0 +1,278 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+type S3Backend struct {
+	client   *s3.S3
+	uploader *s3manager.Uploader
+	bucket   string
+	region   string
+}
+
+func NewS3Backend(sess *session.Session, bucket, region string) *S3Backend {
+	return &S3Backend{
+		client:   s3.New(sess),
+		uploader: s3manager.NewUploader(sess),
+		bucket:   bucket,
+		region:   region,
+	}
+}
+
+func (b *S3Backend) Put(ctx context.Context, key string, body io.Reader, contentType string) error {
+	input := &s3manager.UploadInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+		Body:   body,
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	_, err := b.uploader.UploadWithContext(ctx, input)
+	if err != nil {
+		return fmt.Errorf("error uploading object to S3: %w", err)
+	}
+	return nil
+}
+
+func (b *S3Backend) Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error) {
+	out, err := b.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, nil, wrapS3Error("error getting object from S3", err)
+	}
+
+	info := &ObjectInfo{
+		Key:          key,
+		Size:         aws.Int64Value(out.ContentLength),
+		LastModified: aws.TimeValue(out.LastModified),
+		ContentType:  aws.StringValue(out.ContentType),
+	}
+	return out.Body, info, nil
+}
+
+func (b *S3Backend) GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error) {
+	byteRange := fmt.Sprintf("bytes=%d-", offset)
+	if length >= 0 {
+		byteRange = fmt.Sprintf("bytes=%d-%d", offset, offset+length-1)
+	}
+
+	out, err := b.client.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+		Range:  aws.String(byteRange),
+	})
+	if err != nil {
+		return nil, wrapS3Error("error getting object range from S3", err)
+	}
+	return out.Body, nil
+}
+
+func (b *S3Backend) Delete(ctx context.Context, key string) error {
+	_, err := b.client.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return fmt.Errorf("error deleting object from S3: %w", err)
+	}
+	return nil
+}
+
+// Copy uses CopyObject, which handles objects of up to 5 GB.
+func (b *S3Backend) Copy(ctx context.Context, srcKey, dstKey, contentType string) error {
+	segments := strings.Split(srcKey, "/")
+	for i, segment := range segments {
+		segments[i] = url.PathEscape(segment)
+	}
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(b.bucket),
+		Key:        aws.String(dstKey),
+		CopySource: aws.String(b.bucket + "/" + strings.Join(segments, "/")),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+		input.MetadataDirective = aws.String(s3.MetadataDirectiveReplace)
+	}
+
+	_, err := b.client.CopyObjectWithContext(ctx, input)
+	if err != nil {
+		return wrapS3Error("error copying object in S3", err)
+	}
+	return nil
+}
+
+func (b *S3Backend) Stat(ctx context.Context, key string) (*ObjectInfo, error) {
+	out, err := b.client.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, wrapS3Error("error reading object metadata from S3", err)
+	}
+
+	return &ObjectInfo{
+		Key:          key,
+		Size:         aws.Int64Value(out.ContentLength),
+		LastModified: aws.TimeValue(out.LastModified),
+		ContentType:  aws.StringValue(out.ContentType),
+	}, nil
+}
+
+func (b *S3Backend) List(ctx context.Context, prefix string) ([]ObjectInfo, error) {
+	var objects []ObjectInfo
+	err := b.client.ListObjectsV2PagesWithContext(ctx, &s3.ListObjectsV2Input{
+		Bucket: aws.String(b.bucket),
+		Prefix: aws.String(prefix),
+	}, func(page *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, obj := range page.Contents {
+			objects = append(objects, ObjectInfo{
+				Key:          aws.StringValue(obj.Key),
+				Size:         aws.Int64Value(obj.Size),
+				LastModified: aws.TimeValue(obj.LastModified),
+			})
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error listing objects in S3: %w", err)
+	}
+	return objects, nil
+}
+
+// S3 rejects multipart parts smaller than 5 MiB other than the last.
+func (b *S3Backend) MinPartSize() int64 {
+	return 5 << 20
+}
+
+func (b *S3Backend) CreateMultipart(ctx context.Context, key, contentType string) (string, error) {
+	input := &s3.CreateMultipartUploadInput{
+		Bucket: aws.String(b.bucket),
+		Key:    aws.String(key),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+
+	out, err := b.client.CreateMultipartUploadWithContext(ctx, input)
+	if err != nil {
+		return "", fmt.Errorf("error creating multipart upload in S3: %w", err)
+	}
+	return aws.StringValue(out.UploadId), nil
+}
+
+func (b *S3Backend) UploadPart(ctx context.Context, key, uploadID string, number int, body io.ReadSeeker, size int64) (string, error) {
+	out, err := b.client.UploadPartWithContext(ctx, &s3.UploadPartInput{
+		Bucket:        aws.String(b.bucket),
+		Key:           aws.String(key),
+		UploadId:      aws.String(uploadID),
+		PartNumber:    aws.Int64(int64(number)),
+		Body:          body,
+		ContentLength: aws.Int64(size),
+	})
+	if err != nil {
+		return "", wrapS3Error("error uploading part to S3", err)
+	}
+	return aws.StringValue(out.ETag), nil
+}
+
+func (b *S3Backend) CompleteMultipart(ctx context.Context, key, uploadID string, parts []CompletedPart) error {
+	completed := make([]*s3.CompletedPart, len(parts))
+	for i, part := range parts {
+		completed[i] = &s3.CompletedPart{
+			ETag:       aws.String(part.ETag),
+			PartNumber: aws.Int64(int64(part.Number)),
+		}
+	}
+
+	_, err := b.client.CompleteMultipartUploadWithContext(ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(b.bucket),
+		Key:             aws.String(key),
+		UploadId:        aws.String(uploadID),
+		MultipartUpload: &s3.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return wrapS3Error("error completing multipart upload in S3", err)
+	}
+	return nil
+}
+
+func (b *S3Backend) AbortMultipart(ctx context.Context, key, uploadID string) error {
+	_, err := b.client.AbortMultipartUploadWithContext(ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(b.bucket),
+		Key:      aws.String(key),
+		UploadId: aws.String(uploadID),
+	})
+	if err != nil {
+		return wrapS3Error("error aborting multipart upload in S3", err)
+	}
+	return nil
+}
+
+func (b *S3Backend) URL(key string) string {
+	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", b.bucket, b.region, key)
+}
+
+func wrapS3Error(msg string, err error) error {
+	var reqErr awserr.RequestFailure
+	if errors.As(err, &reqErr) && reqErr.StatusCode() == http.StatusNotFound {
+		return fmt.Errorf("%s: %w", msg, ErrNotFound)
+	}
+	return fmt.Errorf("%s: %w", msg, err)
+}
+
+// PresignPut returns a URL for a single PUT of exactly size bytes. Clients
+// must send the same Content-Type, which is part of the signature.
+func (b *S3Backend) PresignPut(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (string, error) {
+	input := &s3.PutObjectInput{
+		Bucket:        aws.String(b.bucket),
+		Key:           aws.String(key),
+		ContentLength: aws.Int64(size),
+	}
+	if contentType != "" {
+		input.ContentType = aws.String(contentType)
+	}
+	req, _ := b.client.PutObjectRequest(input)
+	req.SetContext(ctx)
+	signed, err := req.Presign(ttl)
+	if err != nil {
+		return "", fmt.Errorf("error presigning S3 upload: %w", err)
+	}
+	return signed, nil
+}
+
+func (b *S3Backend) PresignGet(ctx context.Context, key, fileName, contentType string, ttl time.Duration) (string, error) {
+	input := &s3.GetObjectInput{
+		Bucket:                     aws.String(b.bucket),
+		Key:                        aws.String(key),
+		ResponseContentDisposition: aws.String(mime.FormatMediaType("attachment", map[string]string{"filename": fileName})),
+	}
+	if contentType != "" {
+		input.ResponseContentType = aws.String(contentType)
+	}
+	req, _ := b.client.GetObjectRequest(input)
+	req.SetContext(ctx)
+	signed, err := req.Presign(ttl)
+	if err != nil {
+		return "", fmt.Errorf("error presigning S3 download: %w", err)
+	}
+	return signed, nil
+}
@@ -0,0 +1,57 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"io"
+	"time"
+)
+
+var (
+	ErrNotFound         = errors.New("object not found")
+	ErrInvalidSignature = errors.New("invalid or expired signature")
+)
+
+type ObjectInfo struct {
+	Key          string
+	Size         int64
+	LastModified time.Time
+	ContentType  string
+}
+
+type Backend interface {
+	Put(ctx context.Context, key string, body io.Reader, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, *ObjectInfo, error)
+	GetRange(ctx context.Context, key string, offset, length int64) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+	// Copy copies an object within the backend without reading it back
+	// through the caller. A non-empty contentType replaces the stored one.
+	Copy(ctx context.Context, srcKey, dstKey, contentType string) error
+	Stat(ctx context.Context, key string) (*ObjectInfo, error)
+	List(ctx context.Context, prefix string) ([]ObjectInfo, error)
+	URL(key string) string
+}
+
+type CompletedPart struct {
+	Number int    `json:"number"`
+	ETag   string `json:"etag"`
+}
+
+// MultipartBackend is implemented by backends that can assemble an object
+// from parts uploaded separately, which resumable uploads depend on. Every
+// part except the last must be at least MinPartSize bytes.
+type MultipartBackend interface {
+	MinPartSize() int64
+	CreateMultipart(ctx context.Context, key, contentType string) (uploadID string, err error)
+	UploadPart(ctx context.Context, key, uploadID string, number int, body io.ReadSeeker, size int64) (etag string, err error)
+	CompleteMultipart(ctx context.Context, key, uploadID string, parts []CompletedPart) error
+	AbortMultipart(ctx context.Context, key, uploadID string) error
+}
+
+// Presigner is implemented by backends that can issue short-lived URLs
+// letting clients write or read an object directly instead of proxying the
+// bytes through the API.
+type Presigner interface {
+	PresignPut(ctx context.Context, key, contentType string, size int64, ttl time.Duration) (string, error)
+	PresignGet(ctx context.Context, key, fileName, contentType string, ttl time.Duration) (string, error)
+}
@@ -3,86 +3,104 @@ package utils
 import (
 	"authentication/config"
 	"authentication/models"
+	"authentication/storage"
+	"errors"
 	"fmt"
-	"log"
-	"strings"
 	"time"
-
-	"github.com/aws/aws-sdk-go/aws"
-	"github.com/aws/aws-sdk-go/aws/session"
-	"github.com/aws/aws-sdk-go/service/s3"
 )
 
-func initS3Session() *s3.S3 {
-	sess, err := session.NewSession(&aws.Config{
-		Region: aws.String("eu-north-1"),
-	})
-	if err != nil {
-		log.Fatalf("failed to create session: %v", err)
-	}
-	return s3.New(sess)
-}
-
 func DeleteExpiredFiles() {
-	s3Client := initS3Session()
-
 	for {
-		files, err := getExpiredFiles()
-		if err != nil {
-			time.Sleep(1 * time.Minute)
-			continue
+		files, err := models.GetExpiredFiles()
+		if err == nil {
+			for _, file := range files {
+				purgeFile(file)
+			}
 		}
 
-		for _, file := range files {
-			err := deleteFileFromS3(s3Client, file.FileURL)
-			if err != nil {
-				continue
+		trashed, err := models.GetFilesTrashedBefore(time.Now().Add(-config.TrashRetention))
+		if err == nil {
+			for _, file := range trashed {
+				purgeFile(file)
 			}
+		}
+
+		reapAbandonedUploads()
+		reapPendingUploads()
+
+		time.Sleep(1 * time.Minute)
+	}
+}
+
+// reapAbandonedUploads discards resumable uploads that have not received a
+// chunk within config.ResumableUploadTTL, including their stored parts.
+func reapAbandonedUploads() {
+	sessions, err := models.GetExpiredUploadSessions()
+	if err != nil {
+		return
+	}
 
-			err = deleteFileMetadata(file.FileID)
-			if err != nil {
+	backend, ok := config.Storage.(storage.MultipartBackend)
+	for _, session := range sessions {
+		if ok {
+			err := backend.AbortMultipart(config.Ctx, session.ObjectKey, session.StorageUploadID)
+			if err != nil && !errors.Is(err, storage.ErrNotFound) {
 				continue
 			}
 		}
+		models.DeleteUploadSession(session.ID)
+	}
+}
 
-		time.Sleep(1 * time.Minute)
+// reapPendingUploads discards expired presigned uploads along with any
+// object left at their staged key, which for completed uploads can only
+// have been written after completion.
+func reapPendingUploads() {
+	pending, err := models.GetExpiredPendingUploads()
+	if err != nil {
+		return
+	}
+	for _, upload := range pending {
+		if err := config.Storage.Delete(config.Ctx, upload.ObjectKey); err != nil {
+			continue
+		}
+		models.DeletePendingUpload(upload.ID)
 	}
 }
 
-func getExpiredFiles() ([]models.FileMetadata, error) {
-	rows, err := config.DB.Query(`
-		SELECT id, file_name, file_size, s3_url, file_extension, shared_user, expiry_date
-		FROM files
-		WHERE expiry_date <= NOW()
-	`)
+func purgeFile(file models.FileMetadata) error {
+	versions, err := models.GetFileVersions(file.FileID)
+	if err != nil {
+		return err
+	}
+
+	err = deleteFileMetadata(file.FileID)
 	if err != nil {
-		return nil, fmt.Errorf("error querying expired files: %w", err)
+		return err
 	}
-	defer rows.Close()
 
-	var files []models.FileMetadata
-	for rows.Next() {
-		var file models.FileMetadata
-		err := rows.Scan(&file.FileID, &file.FileName, &file.FileSize, &file.FileURL, &file.FileType, &file.SharedUser, &file.ExpiryDate)
+	// Each version holds a reference to its blob; the object itself is only
+	// deleted once no other file or version refers to it.
+	for _, version := range versions {
+		orphaned, err := models.ReleaseBlob(version.ObjectKey)
 		if err != nil {
-			return nil, fmt.Errorf("error scanning expired file: %w", err)
+			return fmt.Errorf("error releasing blob: %w", err)
+		}
+		if !orphaned {
+			continue
+		}
+		if err := deleteFileFromStorage(version.ObjectKey); err != nil {
+			return err
 		}
-		files = append(files, file)
 	}
 
-	return files, nil
+	return nil
 }
 
-func deleteFileFromS3(s3Client *s3.S3, s3URL string) error {
-	bucketName := "go-file-management-system-bucket"
-	objectKey := extractObjectKey(s3URL)
-
-	_, err := s3Client.DeleteObject(&s3.DeleteObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(objectKey),
-	})
+func deleteFileFromStorage(objectKey string) error {
+	err := config.Storage.Delete(config.Ctx, objectKey)
 	if err != nil {
-		return fmt.Errorf("error deleting object from S3: %w", err)
+		return fmt.Errorf("error deleting object from storage: %w", err)
 	}
 
 	return nil
@@ -95,7 +113,3 @@ func deleteFileMetadata(fileID int) error {
 	}
 	return nil
 }
-
-func extractObjectKey(s3URL string) string {
-	return s3URL[strings.LastIndex(s3URL, "/")+1:]
-}
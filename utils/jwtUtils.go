@@ -3,32 +3,63 @@ package utils
 import (
 	"authentication/config"
 	"fmt"
+	"time"
 
 	"github.com/dgrijalva/jwt-go"
 )
 
-var secretKey = []byte("your_secret_key")
-
 type Claims struct {
-	Email string `json:"email"`
+	Email  string   `json:"email"`
+	UserID int      `json:"uid,omitempty"`
+	Scopes []string `json:"scopes,omitempty"`
+	// Purpose restricts a token to a single step such as completing an MFA
+	// login. Only tokens without a purpose grant API access.
+	Purpose string `json:"purpose,omitempty"`
+	// IssuedAtNano is the issue time with more precision than iat, so a
+	// session started right after its user's sessions were revoked is kept.
+	IssuedAtNano int64 `json:"iat_ns,omitempty"`
 	jwt.StandardClaims
 }
 
+func (c *Claims) issuedAtNano() int64 {
+	if c.IssuedAtNano != 0 {
+		return c.IssuedAtNano
+	}
+	return time.Unix(c.IssuedAt, 0).UnixNano()
+}
+
 func GenerateJWT(claims *Claims) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-	return token.SignedString(secretKey)
+	key := currentKeys().signing
+	token := jwt.NewWithClaims(key.Method, claims)
+	token.Header["kid"] = key.ID
+	return token.SignedString(key.Private)
 }
 
 func ParseToken(tokenString string) (*Claims, error) {
-	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, func(token *jwt.Token) (interface{}, error) {
-		return secretKey, nil
-	})
+	token, err := jwt.ParseWithClaims(tokenString, &Claims{}, currentKeys().verificationKey)
 	if err != nil {
 		return nil, err
 	}
 	claims, ok := token.Claims.(*Claims)
 	if !ok || !token.Valid {
-		return nil, err
+		return nil, fmt.Errorf("invalid token")
+	}
+	// Tokens issued before logout support carry no jti and cannot be revoked.
+	if claims.Id != "" {
+		revoked, err := isTokenRevoked(claims.Id)
+		if err != nil {
+			return nil, fmt.Errorf("failed to check token revocation: %v", err)
+		}
+		if revoked {
+			return nil, fmt.Errorf("token has been revoked")
+		}
+		revoked, err = sessionsRevokedSince(claims.UserID, claims.issuedAtNano())
+		if err != nil {
+			return nil, fmt.Errorf("failed to check token revocation: %v", err)
+		}
+		if revoked {
+			return nil, fmt.Errorf("token has been revoked")
+		}
 	}
 	return claims, nil
 }
@@ -0,0 +1,116 @@
+package utils
+
+import (
+	"authentication/config"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/go-redis/redis/v8"
+)
+
+const (
+	// Failures per account before it is locked for LoginLockoutDuration.
+	loginAccountMaxFailures = 10
+	// Failures per client IP, across all accounts, within the window.
+	loginIPMaxFailures = 50
+	// Account failures allowed before each further attempt is delayed.
+	loginBackoffAfter = 3
+	loginBackoffMax   = 5 * time.Minute
+)
+
+func normalizeLoginEmail(email string) string {
+	return strings.ToLower(strings.TrimSpace(email))
+}
+
+func loginAccountFailuresKey(email string) string {
+	return fmt.Sprintf("login_failures_account_%s", normalizeLoginEmail(email))
+}
+
+func loginIPFailuresKey(ip string) string {
+	return fmt.Sprintf("login_failures_ip_%s", ip)
+}
+
+func loginBackoffKey(email string) string {
+	return fmt.Sprintf("login_backoff_%s", normalizeLoginEmail(email))
+}
+
+func loginLockKey(email string) string {
+	return fmt.Sprintf("login_locked_%s", normalizeLoginEmail(email))
+}
+
+// LoginRetryAfter reports how long the caller must wait before another
+// login attempt for email from ip is allowed. Counters are keyed by the
+// submitted email whether or not the account exists.
+func LoginRetryAfter(email, ip string) (time.Duration, error) {
+	var wait time.Duration
+	for _, key := range []string{loginLockKey(email), loginBackoffKey(email)} {
+		ttl, err := config.RedisClient.PTTL(config.Ctx, key).Result()
+		if err != nil {
+			return 0, err
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+	}
+
+	failures, err := config.RedisClient.Get(config.Ctx, loginIPFailuresKey(ip)).Int()
+	if err != nil && err != redis.Nil {
+		return 0, err
+	}
+	if failures >= loginIPMaxFailures {
+		ttl, err := config.RedisClient.PTTL(config.Ctx, loginIPFailuresKey(ip)).Result()
+		if err != nil {
+			return 0, err
+		}
+		if ttl > wait {
+			wait = ttl
+		}
+	}
+	return wait, nil
+}
+
+// incrementScript starts the expiry window on the first increment so a
+// counter cannot be left without a TTL.
+var incrementScript = redis.NewScript(`
+local count = redis.call("INCR", KEYS[1])
+if count == 1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[1])
+end
+return count
+`)
+
+func incrementWithin(key string, window time.Duration) (int64, error) {
+	return incrementScript.Run(config.Ctx, config.RedisClient, []string{key}, window.Milliseconds()).Int64()
+}
+
+// RecordLoginFailure counts a failed attempt and applies exponential backoff
+// and, past the limit, a temporary lockout to the account.
+func RecordLoginFailure(email, ip string) error {
+	if _, err := incrementWithin(loginIPFailuresKey(ip), config.LoginFailureWindow); err != nil {
+		return err
+	}
+
+	failures, err := incrementWithin(loginAccountFailuresKey(email), config.LoginFailureWindow)
+	if err != nil {
+		return err
+	}
+
+	if failures >= loginAccountMaxFailures {
+		return config.RedisClient.Set(config.Ctx, loginLockKey(email), 1, config.LoginLockoutDuration).Err()
+	}
+	if failures >= loginBackoffAfter {
+		backoff := time.Second << (failures - loginBackoffAfter)
+		if backoff > loginBackoffMax {
+			backoff = loginBackoffMax
+		}
+		return config.RedisClient.Set(config.Ctx, loginBackoffKey(email), 1, backoff).Err()
+	}
+	return nil
+}
+
+// ClearLoginFailures resets the account counters after a successful login or
+// an administrator unlock. Per-IP counters are left to expire.
+func ClearLoginFailures(email string) error {
+	return config.RedisClient.Del(config.Ctx, loginAccountFailuresKey(email), loginBackoffKey(email), loginLockKey(email)).Err()
+}
@@ -0,0 +1,59 @@
+package utils
+
+import (
+	"authentication/config"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoginThrottleBackoffAndLockout(t *testing.T) {
+	server := useMiniredis(t)
+
+	for i := 1; i < loginBackoffAfter; i++ {
+		assert.NoError(t, RecordLoginFailure("Test@Example.com", "10.0.0.1"))
+	}
+	wait, err := LoginRetryAfter("test@example.com", "10.0.0.1")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+
+	assert.NoError(t, RecordLoginFailure("test@example.com", "10.0.0.1"))
+	wait, err = LoginRetryAfter("test@example.com", "10.0.0.2")
+	assert.NoError(t, err)
+	assert.Equal(t, time.Second, wait)
+
+	for i := loginBackoffAfter; i < loginAccountMaxFailures; i++ {
+		assert.NoError(t, RecordLoginFailure("test@example.com", "10.0.0.1"))
+	}
+	wait, err = LoginRetryAfter("test@example.com", "10.0.0.2")
+	assert.NoError(t, err)
+	assert.Equal(t, config.LoginLockoutDuration, wait)
+
+	server.FastForward(config.LoginLockoutDuration)
+	wait, err = LoginRetryAfter("test@example.com", "10.0.0.2")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+
+	assert.NoError(t, RecordLoginFailure("test@example.com", "10.0.0.1"))
+	assert.NoError(t, ClearLoginFailures("test@example.com"))
+	wait, err = LoginRetryAfter("test@example.com", "10.0.0.2")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+}
+
+func TestLoginThrottlePerIP(t *testing.T) {
+	useMiniredis(t)
+
+	for i := 0; i < loginIPMaxFailures; i++ {
+		assert.NoError(t, RecordLoginFailure("user"+string(rune('a'+i%26))+"@example.com", "10.0.0.9"))
+	}
+
+	wait, err := LoginRetryAfter("someone-else@example.com", "10.0.0.9")
+	assert.NoError(t, err)
+	assert.Equal(t, config.LoginFailureWindow, wait)
+
+	wait, err = LoginRetryAfter("someone-else@example.com", "10.0.0.10")
+	assert.NoError(t, err)
+	assert.Zero(t, wait)
+}
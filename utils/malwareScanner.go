@@ -0,0 +1,88 @@
+package utils
+
+import (
+	"authentication/config"
+	"authentication/models"
+	"authentication/storage"
+	"errors"
+	"log"
+	"strings"
+	"time"
+)
+
+const (
+	scanBatchSize = 20
+	// quarantinePrefix is where infected objects are moved, out of reach of
+	// the keys files were uploaded under.
+	quarantinePrefix = "quarantine/"
+)
+
+// ScanUploadedObjects passes every newly uploaded object through
+// config.Scanner. Files stay blocked from sharing and download until their
+// content is found clean; infected objects are quarantined.
+func ScanUploadedObjects() {
+	for {
+		keys, err := models.GetObjectsPendingScan(scanBatchSize)
+		failed := err != nil
+		for _, key := range keys {
+			if err := scanStoredObject(key); err != nil {
+				log.Printf("Error scanning object %s: %v", key, err)
+				failed = true
+			}
+		}
+
+		if failed || len(keys) < scanBatchSize {
+			time.Sleep(config.ScanPollInterval)
+		}
+	}
+}
+
+// scanStoredObject scans one object. Errors leave it pending so that it is
+// retried. A missing object can never be shown to be clean, so it stays
+// blocked rather than being retried forever.
+func scanStoredObject(objectKey string) error {
+	body, _, err := config.Storage.Get(config.Ctx, objectKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Cannot scan object %s: it is missing; blocking access", objectKey)
+		return models.RecordScanResult(objectKey, models.ScanStatusInfected)
+	}
+	if err != nil {
+		return err
+	}
+	result, err := config.Scanner.Scan(config.Ctx, body)
+	body.Close()
+	if err != nil {
+		return err
+	}
+
+	if !result.Infected {
+		return models.RecordScanResult(objectKey, models.ScanStatusClean)
+	}
+	log.Printf("Malware detected in object %s: %s", objectKey, result.Signature)
+	return quarantineObject(objectKey)
+}
+
+// quarantineObject moves an infected object under quarantinePrefix. The
+// original is only deleted once the database refers to the copy.
+func quarantineObject(objectKey string) error {
+	if strings.HasPrefix(objectKey, quarantinePrefix) {
+		return models.RecordScanResult(objectKey, models.ScanStatusInfected)
+	}
+
+	quarantineKey := quarantinePrefix + objectKey
+	body, info, err := config.Storage.Get(config.Ctx, objectKey)
+	if err != nil {
+		return err
+	}
+	err = config.Storage.Put(config.Ctx, quarantineKey, body, info.ContentType)
+	body.Close()
+	if err != nil {
+		return err
+	}
+
+	if err := models.QuarantineObject(objectKey, quarantineKey, config.Storage.URL(quarantineKey)); err != nil {
+		config.Storage.Delete(config.Ctx, quarantineKey)
+		return err
+	}
+	return config.Storage.Delete(config.Ctx, objectKey)
+}
@@ -0,0 +1,70 @@
+package utils
+
+import (
+	"authentication/config"
+	"authentication/scanner"
+	"authentication/storage"
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestScanStoredObject(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+	config.Scanner = scanner.NewStubScanner()
+	ctx := context.Background()
+	assert.NoError(t, backend.Put(ctx, "1/clean.txt", strings.NewReader("hello world"), ""))
+	assert.NoError(t, backend.Put(ctx, "1/eicar.com", strings.NewReader(scanner.EICARSignature), ""))
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE file_versions SET scan_status").
+		WithArgs("1/clean.txt", "clean").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE files SET scan_status").
+		WithArgs("1/clean.txt", "clean").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	mock.ExpectBegin()
+	mock.ExpectExec("UPDATE file_versions").
+		WithArgs("1/eicar.com", "quarantine/1/eicar.com").
+		WillReturnResult(sqlmock.NewResult(0, 2))
+	mock.ExpectExec("UPDATE files").
+		WithArgs("1/eicar.com", "quarantine/1/eicar.com", backend.URL("quarantine/1/eicar.com")).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE blobs SET object_key").
+		WithArgs("1/eicar.com", "quarantine/1/eicar.com").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectCommit()
+
+	assert.NoError(t, scanStoredObject("1/clean.txt"))
+	assert.NoError(t, scanStoredObject("1/eicar.com"))
+
+	_, err = backend.Stat(ctx, "1/eicar.com")
+	assert.ErrorIs(t, err, storage.ErrNotFound)
+	body, _, err := backend.Get(ctx, "quarantine/1/eicar.com")
+	if assert.NoError(t, err) {
+		content, _ := io.ReadAll(body)
+		body.Close()
+		assert.Equal(t, scanner.EICARSignature, string(content))
+	}
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"bytes"
+	"encoding/binary"
+	"mime"
+	"net/http"
+)
+
+// SniffLength is how many leading bytes DetectMIMEType looks at.
+const SniffLength = 512
+
+// executableSignatures covers the formats http.DetectContentType reports as
+// plain octet streams or text, so that policies can single them out.
+var executableSignatures = []struct {
+	magic    []byte
+	mimeType string
+}{
+	{[]byte("\x7fELF"), "application/x-executable"},
+	{[]byte("\xfe\xed\xfa\xce"), "application/x-mach-binary"},
+	{[]byte("\xfe\xed\xfa\xcf"), "application/x-mach-binary"},
+	{[]byte("\xce\xfa\xed\xfe"), "application/x-mach-binary"},
+	{[]byte("\xcf\xfa\xed\xfe"), "application/x-mach-binary"},
+	{[]byte("\xca\xfe\xba\xbe"), "application/x-mach-binary"},
+	{[]byte("#!"), "text/x-shellscript"},
+}
+
+// isPEExecutable reports whether head starts a Windows PE image: an MZ
+// header whose e_lfanew field points at the PE signature. "MZ" alone also
+// starts plenty of text.
+func isPEExecutable(head []byte) bool {
+	const lfanewOffset = 0x3c
+	if !bytes.HasPrefix(head, []byte("MZ")) || len(head) < lfanewOffset+4 {
+		return false
+	}
+	peOffset := int64(binary.LittleEndian.Uint32(head[lfanewOffset:]))
+	return peOffset+4 <= int64(len(head)) && bytes.Equal(head[peOffset:peOffset+4], []byte("PE\x00\x00"))
+}
+
+// DetectMIMEType identifies content from its first bytes, ignoring whatever
+// name or Content-Type the client claimed. Parameters such as charset are
+// dropped.
+func DetectMIMEType(head []byte) string {
+	if len(head) > SniffLength {
+		head = head[:SniffLength]
+	}
+	if isPEExecutable(head) {
+		return "application/x-msdownload"
+	}
+	for _, signature := range executableSignatures {
+		if bytes.HasPrefix(head, signature.magic) {
+			return signature.mimeType
+		}
+	}
+
+	detected := http.DetectContentType(head)
+	if mediaType, _, err := mime.ParseMediaType(detected); err == nil {
+		return mediaType
+	}
+	return detected
+}
@@ -0,0 +1,29 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDetectMIMEType(t *testing.T) {
+	// An MZ header whose e_lfanew at 0x3c points at the PE signature at 0x40.
+	peImage := "MZ\x90\x00" + strings.Repeat("\x00", 0x38) + "\x40\x00\x00\x00" + "PE\x00\x00\x4c\x01"
+	tests := map[string]string{
+		"hello world":                  "text/plain",
+		"%PDF-1.7\n":                   "application/pdf",
+		"\x89PNG\r\n\x1a\n\x00\x00":    "image/png",
+		peImage:                        "application/x-msdownload",
+		"MZ report.txt":                "text/plain",
+		"MZ\x90\x00\x03\x00\x00\x00":   "application/octet-stream",
+		"\x7fELF\x02\x01\x01\x00":      "application/x-executable",
+		"\xcf\xfa\xed\xfe\x07\x00":     "application/x-mach-binary",
+		"#!/bin/sh\nrm -rf /\n":        "text/x-shellscript",
+		"<!DOCTYPE html><html></html>": "text/html",
+		"\x00\x01\x02\x03":             "application/octet-stream",
+	}
+	for content, expected := range tests {
+		assert.Equal(t, expected, DetectMIMEType([]byte(content)), "content %q", content)
+	}
+}
@@ -0,0 +1,61 @@
+package utils
+
+import (
+	"authentication/config"
+	"authentication/models"
+	"authentication/storage"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"time"
+)
+
+const scrubBatchSize = 100
+
+// ScrubStoredObjects re-reads every stored object once per
+// config.ScrubInterval and compares it with the SHA-256 recorded at upload,
+// flagging the versions of any object that is missing or altered.
+func ScrubStoredObjects() {
+	for {
+		objects, err := models.GetObjectsDueForVerification(time.Now().Add(-config.ScrubInterval), scrubBatchSize)
+		failed := err != nil
+		for _, object := range objects {
+			if err := verifyStoredObject(object); err != nil {
+				log.Printf("Error verifying object %s: %v", object.ObjectKey, err)
+				failed = true
+			}
+		}
+
+		if failed || len(objects) < scrubBatchSize {
+			time.Sleep(1 * time.Minute)
+		}
+	}
+}
+
+// verifyStoredObject checks one object. Storage errors other than a missing
+// object are returned without flagging anything, since they may be
+// transient.
+func verifyStoredObject(object models.StoredObject) error {
+	body, _, err := config.Storage.Get(config.Ctx, object.ObjectKey)
+	if errors.Is(err, storage.ErrNotFound) {
+		log.Printf("Integrity check failed: object %s is missing", object.ObjectKey)
+		return models.RecordVerification(object.ObjectKey, false)
+	}
+	if err != nil {
+		return err
+	}
+	defer body.Close()
+
+	hasher := sha256.New()
+	if _, err := io.Copy(hasher, body); err != nil {
+		return err
+	}
+
+	intact := hex.EncodeToString(hasher.Sum(nil)) == object.SHA256
+	if !intact {
+		log.Printf("Integrity check failed: object %s does not match its recorded SHA-256", object.ObjectKey)
+	}
+	return models.RecordVerification(object.ObjectKey, intact)
+}
@@ -0,0 +1,57 @@
+package utils
+
+import (
+	"authentication/config"
+	"authentication/models"
+	"authentication/storage"
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/DATA-DOG/go-sqlmock"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestVerifyStoredObject(t *testing.T) {
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatalf("failed to open sqlmock database: %v", err)
+	}
+	config.DB = db
+	defer db.Close()
+
+	backend, err := storage.NewLocalBackend(t.TempDir())
+	if err != nil {
+		t.Fatalf("failed to create local storage: %v", err)
+	}
+	config.Storage = backend
+	ctx := context.Background()
+	assert.NoError(t, backend.Put(ctx, "1/intact.txt", strings.NewReader("hello world"), ""))
+	assert.NoError(t, backend.Put(ctx, "1/altered.txt", strings.NewReader("hello there"), ""))
+
+	const helloWorld = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+
+	mock.ExpectExec("UPDATE file_versions").
+		WithArgs("1/intact.txt", true).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE file_versions").
+		WithArgs("1/altered.txt", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE blobs SET corrupted_at").
+		WithArgs("1/altered.txt").
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE file_versions").
+		WithArgs("1/missing.txt", false).
+		WillReturnResult(sqlmock.NewResult(0, 1))
+	mock.ExpectExec("UPDATE blobs SET corrupted_at").
+		WithArgs("1/missing.txt").
+		WillReturnResult(sqlmock.NewResult(0, 0))
+
+	assert.NoError(t, verifyStoredObject(models.StoredObject{ObjectKey: "1/intact.txt", SHA256: helloWorld}))
+	assert.NoError(t, verifyStoredObject(models.StoredObject{ObjectKey: "1/altered.txt", SHA256: helloWorld}))
+	assert.NoError(t, verifyStoredObject(models.StoredObject{ObjectKey: "1/missing.txt", SHA256: helloWorld}))
+
+	if err := mock.ExpectationsWereMet(); err != nil {
+		t.Errorf("there were unfulfilled expectations: %s", err)
+	}
+}
@@ -0,0 +1,204 @@
+package utils
+
+import (
+	"authentication/config"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v8"
+)
+
+var (
+	ErrInvalidRefreshToken = errors.New("invalid refresh token")
+	ErrInvalidMFAChallenge = errors.New("invalid or expired MFA challenge")
+)
+
+const (
+	PurposeMFA = "mfa"
+
+	mfaChallengeTTL = 5 * time.Minute
+)
+
+type Session struct {
+	AccessToken      string
+	AccessExpiresAt  time.Time
+	RefreshToken     string
+	RefreshExpiresAt time.Time
+}
+
+type refreshRecord struct {
+	UserID int    `json:"user_id"`
+	Email  string `json:"email"`
+}
+
+func refreshTokenKey(token string) string {
+	return fmt.Sprintf("refresh_token_%s", HashToken(token))
+}
+
+func revokedTokenKey(jti string) string {
+	return fmt.Sprintf("revoked_token_%s", jti)
+}
+
+// userRefreshTokensKey indexes a user's refresh token keys so that all of
+// their sessions can be revoked at once.
+func userRefreshTokensKey(userID int) string {
+	return fmt.Sprintf("user_refresh_tokens_%d", userID)
+}
+
+func sessionsRevokedKey(userID int) string {
+	return fmt.Sprintf("sessions_revoked_at_%d", userID)
+}
+
+// IssueSession signs a short-lived access token and stores a single-use
+// refresh token for it in Redis.
+func IssueSession(userID int, email string) (*Session, error) {
+	jti, err := GenerateSecureToken(16)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	session := &Session{
+		AccessExpiresAt:  now.Add(config.AccessTokenTTL),
+		RefreshExpiresAt: now.Add(config.RefreshTokenTTL),
+	}
+	session.AccessToken, err = GenerateJWT(&Claims{
+		Email:        email,
+		UserID:       userID,
+		IssuedAtNano: now.UnixNano(),
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: session.AccessExpiresAt.Unix(),
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	session.RefreshToken, err = GenerateSecureToken(32)
+	if err != nil {
+		return nil, err
+	}
+	record, err := json.Marshal(refreshRecord{UserID: userID, Email: email})
+	if err != nil {
+		return nil, err
+	}
+	key := refreshTokenKey(session.RefreshToken)
+	_, err = config.RedisClient.TxPipelined(config.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.Set(config.Ctx, key, record, config.RefreshTokenTTL)
+		pipe.SAdd(config.Ctx, userRefreshTokensKey(userID), key)
+		pipe.Expire(config.Ctx, userRefreshTokensKey(userID), config.RefreshTokenTTL)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return session, nil
+}
+
+// IssueMFAChallenge signs a short-lived token proving the password step of a
+// login succeeded. It is exchanged for a session once the second factor is
+// verified and cannot be used to call the API.
+func IssueMFAChallenge(userID int, email string) (string, error) {
+	jti, err := GenerateSecureToken(16)
+	if err != nil {
+		return "", err
+	}
+	now := time.Now()
+	return GenerateJWT(&Claims{
+		Email:        email,
+		UserID:       userID,
+		Purpose:      PurposeMFA,
+		IssuedAtNano: now.UnixNano(),
+		StandardClaims: jwt.StandardClaims{
+			Id:        jti,
+			IssuedAt:  now.Unix(),
+			ExpiresAt: now.Add(mfaChallengeTTL).Unix(),
+		},
+	})
+}
+
+func ParseMFAChallenge(token string) (*Claims, error) {
+	claims, err := ParseToken(token)
+	if err != nil || claims.Purpose != PurposeMFA || claims.UserID == 0 {
+		return nil, ErrInvalidMFAChallenge
+	}
+	return claims, nil
+}
+
+// RefreshSession consumes a refresh token and issues a new session in its
+// place, so each refresh token can be used at most once.
+func RefreshSession(refreshToken string) (*Session, error) {
+	key := refreshTokenKey(refreshToken)
+	data, err := config.RedisClient.Get(config.Ctx, key).Bytes()
+	if err == redis.Nil {
+		return nil, ErrInvalidRefreshToken
+	} else if err != nil {
+		return nil, err
+	}
+
+	// Only the caller that actually deletes the key may rotate it.
+	deleted, err := config.RedisClient.Del(config.Ctx, key).Result()
+	if err != nil {
+		return nil, err
+	}
+	if deleted == 0 {
+		return nil, ErrInvalidRefreshToken
+	}
+
+	var record refreshRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	config.RedisClient.SRem(config.Ctx, userRefreshTokensKey(record.UserID), key)
+	return IssueSession(record.UserID, record.Email)
+}
+
+func RevokeRefreshToken(refreshToken string) error {
+	return config.RedisClient.Del(config.Ctx, refreshTokenKey(refreshToken)).Err()
+}
+
+// RevokeUserSessions ends every session of a user, for example after a
+// password reset: all refresh tokens are deleted and access tokens issued
+// until now are rejected for as long as they could still be valid.
+func RevokeUserSessions(userID int) error {
+	keys, err := config.RedisClient.SMembers(config.Ctx, userRefreshTokensKey(userID)).Result()
+	if err != nil {
+		return err
+	}
+	_, err = config.RedisClient.TxPipelined(config.Ctx, func(pipe redis.Pipeliner) error {
+		pipe.Del(config.Ctx, append(keys, userRefreshTokensKey(userID))...)
+		pipe.Set(config.Ctx, sessionsRevokedKey(userID), time.Now().UnixNano(), config.AccessTokenTTL)
+		return nil
+	})
+	return err
+}
+
+// sessionsRevokedSince reports whether the user's sessions were revoked
+// after issuedAt, both in Unix nanoseconds.
+func sessionsRevokedSince(userID int, issuedAt int64) (bool, error) {
+	revokedAt, err := config.RedisClient.Get(config.Ctx, sessionsRevokedKey(userID)).Int64()
+	if err == redis.Nil {
+		return false, nil
+	}
+	return err == nil && issuedAt < revokedAt, err
+}
+
+// RevokeToken denylists an access token by its jti until it would have
+// expired anyway.
+func RevokeToken(jti string, expiresAt time.Time) error {
+	ttl := time.Until(expiresAt)
+	if jti == "" || ttl <= 0 {
+		return nil
+	}
+	return config.RedisClient.Set(config.Ctx, revokedTokenKey(jti), 1, ttl).Err()
+}
+
+func isTokenRevoked(jti string) (bool, error) {
+	count, err := config.RedisClient.Exists(config.Ctx, revokedTokenKey(jti)).Result()
+	return count > 0, err
+}
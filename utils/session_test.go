@@ -0,0 +1,111 @@
+package utils
+
+import (
+	"authentication/config"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/dgrijalva/jwt-go"
+	"github.com/go-redis/redis/v8"
+	"github.com/stretchr/testify/assert"
+)
+
+func useMiniredis(t *testing.T) *miniredis.Miniredis {
+	server := miniredis.RunT(t)
+	config.RedisClient = redis.NewClient(&redis.Options{Addr: server.Addr()})
+	t.Cleanup(func() { config.RedisClient = nil })
+	return server
+}
+
+func TestRefreshSessionRotates(t *testing.T) {
+	useMiniredis(t)
+
+	session, err := IssueSession(1, "test@example.com")
+	assert.NoError(t, err)
+
+	claims, err := ParseToken(session.AccessToken)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, claims.UserID)
+	assert.NotEmpty(t, claims.Id)
+
+	refreshed, err := RefreshSession(session.RefreshToken)
+	assert.NoError(t, err)
+	assert.NotEqual(t, session.RefreshToken, refreshed.RefreshToken)
+
+	_, err = RefreshSession(session.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+
+	assert.NoError(t, RevokeRefreshToken(refreshed.RefreshToken))
+	_, err = RefreshSession(refreshed.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+}
+
+func TestRevokeToken(t *testing.T) {
+	server := useMiniredis(t)
+
+	session, err := IssueSession(1, "test@example.com")
+	assert.NoError(t, err)
+
+	claims, err := ParseToken(session.AccessToken)
+	assert.NoError(t, err)
+
+	assert.NoError(t, RevokeToken(claims.Id, time.Unix(claims.ExpiresAt, 0)))
+	_, err = ParseToken(session.AccessToken)
+	assert.Error(t, err)
+
+	ttl := server.TTL(revokedTokenKey(claims.Id))
+	assert.True(t, ttl > 0 && ttl <= config.AccessTokenTTL)
+}
+
+func TestRevokeUserSessions(t *testing.T) {
+	useMiniredis(t)
+
+	first, err := IssueSession(1, "test@example.com")
+	assert.NoError(t, err)
+	second, err := RefreshSession(first.RefreshToken)
+	assert.NoError(t, err)
+	other, err := IssueSession(2, "other@example.com")
+	assert.NoError(t, err)
+
+	assert.NoError(t, RevokeUserSessions(1))
+
+	_, err = RefreshSession(second.RefreshToken)
+	assert.ErrorIs(t, err, ErrInvalidRefreshToken)
+	_, err = ParseToken(second.AccessToken)
+	assert.Error(t, err)
+
+	_, err = ParseToken(other.AccessToken)
+	assert.NoError(t, err)
+	_, err = RefreshSession(other.RefreshToken)
+	assert.NoError(t, err)
+}
+
+func TestRevokeUserSessionsKeepsLaterSessions(t *testing.T) {
+	useMiniredis(t)
+
+	before, err := IssueSession(1, "test@example.com")
+	assert.NoError(t, err)
+	assert.NoError(t, RevokeUserSessions(1))
+	after, err := IssueSession(1, "test@example.com")
+	assert.NoError(t, err)
+
+	beforeClaims, err := ParseToken(before.AccessToken)
+	assert.Error(t, err)
+	assert.Nil(t, beforeClaims)
+	afterClaims, err := ParseToken(after.AccessToken)
+	assert.NoError(t, err)
+
+	// Usually both tokens share an iat second with the revocation, which
+	// must not revoke the session started after it.
+	revokedAt, err := config.RedisClient.Get(config.Ctx, sessionsRevokedKey(1)).Int64()
+	assert.NoError(t, err)
+	assert.Less(t, revokedAt, afterClaims.IssuedAtNano)
+
+	// Tokens issued before nanosecond issue times fall back to iat and are
+	// revoked when issued in the second of the revocation.
+	legacy := &Claims{UserID: 1, StandardClaims: jwt.StandardClaims{IssuedAt: time.Unix(0, revokedAt).Unix()}}
+	revoked, err := sessionsRevokedSince(1, legacy.issuedAtNano())
+	assert.NoError(t, err)
+	assert.True(t, revoked)
+}
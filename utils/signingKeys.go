@@ -0,0 +1,222 @@
+package utils
+
+import (
+	"authentication/config"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type signingKey struct {
+	ID      string
+	Method  jwt.SigningMethod
+	Private interface{}
+	Public  interface{}
+}
+
+type keySet struct {
+	signing *signingKey
+	byID    map[string]*signingKey
+}
+
+type JWK struct {
+	Kty string `json:"kty"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	Kid string `json:"kid"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+	Y   string `json:"y,omitempty"`
+}
+
+type JWKSet struct {
+	Keys []JWK `json:"keys"`
+}
+
+var (
+	keys          *keySet
+	ephemeralOnce sync.Once
+	ephemeralKeys *keySet
+)
+
+func currentKeys() *keySet {
+	if keys != nil {
+		return keys
+	}
+	ephemeralOnce.Do(func() {
+		secret := make([]byte, 32)
+		if _, err := rand.Read(secret); err != nil {
+			panic(err)
+		}
+		key := &signingKey{ID: "ephemeral", Method: jwt.SigningMethodHS256, Private: secret, Public: secret}
+		ephemeralKeys = &keySet{signing: key, byID: map[string]*signingKey{key.ID: key}}
+	})
+	return ephemeralKeys
+}
+
+// LoadSigningKeys reads the token keys from configuration. JWT_SECRET adds
+// an HS256 key with kid "default"; JWT_KEYS_DIR holds one PEM file per key,
+// named <kid>.pem, containing an RSA or P-256 private key for signing or a
+// public key that is only trusted for verification. Old keys can stay in the
+// directory after rotation so tokens they signed remain valid until expiry.
+func LoadSigningKeys() error {
+	set := &keySet{byID: map[string]*signingKey{}}
+
+	if config.JWTSecret != "" {
+		secret := []byte(config.JWTSecret)
+		set.byID["default"] = &signingKey{ID: "default", Method: jwt.SigningMethodHS256, Private: secret, Public: secret}
+	}
+
+	if config.JWTKeysDir != "" {
+		paths, err := filepath.Glob(filepath.Join(config.JWTKeysDir, "*.pem"))
+		if err != nil {
+			return err
+		}
+		for _, path := range paths {
+			kid := strings.TrimSuffix(filepath.Base(path), ".pem")
+			key, err := loadPEMKey(kid, path)
+			if err != nil {
+				return fmt.Errorf("loading signing key %s: %v", path, err)
+			}
+			set.byID[kid] = key
+		}
+	}
+
+	if len(set.byID) == 0 {
+		log.Println("No JWT signing keys configured; using an ephemeral key, tokens will not survive a restart")
+		keys = nil
+		return nil
+	}
+
+	if config.JWTSigningKeyID != "" {
+		set.signing = set.byID[config.JWTSigningKeyID]
+		if set.signing == nil || set.signing.Private == nil {
+			return fmt.Errorf("signing key %q is not configured with a private key", config.JWTSigningKeyID)
+		}
+	} else {
+		for _, key := range set.byID {
+			if key.Private == nil {
+				continue
+			}
+			if set.signing != nil {
+				return errors.New("JWT_SIGNING_KEY_ID must be set when several signing keys are configured")
+			}
+			set.signing = key
+		}
+		if set.signing == nil {
+			return errors.New("no private key configured for signing tokens")
+		}
+	}
+
+	keys = set
+	return nil
+}
+
+func loadPEMKey(kid, path string) (*signingKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, errors.New("no PEM data found")
+	}
+
+	var parsed interface{}
+	switch block.Type {
+	case "RSA PRIVATE KEY":
+		parsed, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+	case "EC PRIVATE KEY":
+		parsed, err = x509.ParseECPrivateKey(block.Bytes)
+	case "PRIVATE KEY":
+		parsed, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+	case "PUBLIC KEY":
+		parsed, err = x509.ParsePKIXPublicKey(block.Bytes)
+	default:
+		return nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{ID: kid}
+	switch k := parsed.(type) {
+	case *rsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodRS256, k, &k.PublicKey
+	case *rsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodRS256, k
+	case *ecdsa.PrivateKey:
+		key.Method, key.Private, key.Public = jwt.SigningMethodES256, k, &k.PublicKey
+	case *ecdsa.PublicKey:
+		key.Method, key.Public = jwt.SigningMethodES256, k
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", parsed)
+	}
+
+	if public, ok := key.Public.(*ecdsa.PublicKey); ok && public.Curve != elliptic.P256() {
+		return nil, errors.New("only P-256 keys are supported for ES256")
+	}
+	return key, nil
+}
+
+func (s *keySet) verificationKey(token *jwt.Token) (interface{}, error) {
+	key := s.signing
+	if kid, ok := token.Header["kid"].(string); ok {
+		key = s.byID[kid]
+	}
+	if key == nil {
+		return nil, errors.New("unknown signing key")
+	}
+	if token.Method.Alg() != key.Method.Alg() {
+		return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+	}
+	return key.Public, nil
+}
+
+// JWKS returns the public half of every asymmetric key so other services
+// can verify our tokens. Shared secrets are never published.
+func JWKS() JWKSet {
+	set := JWKSet{Keys: []JWK{}}
+	for _, key := range currentKeys().byID {
+		switch public := key.Public.(type) {
+		case *rsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "RSA",
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Kid: key.ID,
+				N:   base64.RawURLEncoding.EncodeToString(public.N.Bytes()),
+				E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(public.E)).Bytes()),
+			})
+		case *ecdsa.PublicKey:
+			set.Keys = append(set.Keys, JWK{
+				Kty: "EC",
+				Use: "sig",
+				Alg: key.Method.Alg(),
+				Kid: key.ID,
+				Crv: "P-256",
+				X:   base64.RawURLEncoding.EncodeToString(public.X.FillBytes(make([]byte, 32))),
+				Y:   base64.RawURLEncoding.EncodeToString(public.Y.FillBytes(make([]byte, 32))),
+			})
+		}
+	}
+	sort.Slice(set.Keys, func(i, j int) bool { return set.Keys[i].Kid < set.Keys[j].Kid })
+	return set
+}
@@ -0,0 +1,108 @@
+package utils
+
+import (
+	"authentication/config"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func writePEM(t *testing.T, dir, kid, blockType string, der []byte) {
+	data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+	require.NoError(t, os.WriteFile(filepath.Join(dir, kid+".pem"), data, 0o600))
+}
+
+func useKeyConfig(t *testing.T, secret, dir, signingKeyID string) {
+	config.JWTSecret, config.JWTKeysDir, config.JWTSigningKeyID = secret, dir, signingKeyID
+	t.Cleanup(func() {
+		config.JWTSecret, config.JWTKeysDir, config.JWTSigningKeyID = "", "", ""
+		keys = nil
+	})
+	require.NoError(t, LoadSigningKeys())
+}
+
+func testClaims() *Claims {
+	return &Claims{
+		Email: "test@example.com",
+		StandardClaims: jwt.StandardClaims{
+			ExpiresAt: time.Now().Add(time.Hour).Unix(),
+		},
+	}
+}
+
+func TestSigningKeyRotation(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writePEM(t, dir, "rsa-2024", "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(rsaKey))
+
+	ecKey, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	ecDER, err := x509.MarshalPKCS8PrivateKey(ecKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "ec-2025", "PRIVATE KEY", ecDER)
+
+	useKeyConfig(t, "", dir, "rsa-2024")
+	oldToken, err := GenerateJWT(testClaims())
+	require.NoError(t, err)
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(oldToken, &Claims{})
+	require.NoError(t, err)
+	assert.Equal(t, "RS256", parsed.Method.Alg())
+	assert.Equal(t, "rsa-2024", parsed.Header["kid"])
+
+	useKeyConfig(t, "", dir, "ec-2025")
+	newToken, err := GenerateJWT(testClaims())
+	require.NoError(t, err)
+
+	_, err = ParseToken(newToken)
+	assert.NoError(t, err)
+	_, err = ParseToken(oldToken)
+	assert.NoError(t, err)
+
+	jwks := JWKS()
+	require.Len(t, jwks.Keys, 2)
+	assert.Equal(t, "EC", jwks.Keys[0].Kty)
+	assert.Equal(t, "ES256", jwks.Keys[0].Alg)
+	assert.Equal(t, "RSA", jwks.Keys[1].Kty)
+	assert.Equal(t, "AQAB", jwks.Keys[1].E)
+
+	require.NoError(t, os.Remove(filepath.Join(dir, "rsa-2024.pem")))
+	useKeyConfig(t, "", dir, "")
+	_, err = ParseToken(oldToken)
+	assert.Error(t, err)
+}
+
+func TestParseTokenRejectsAlgorithmMismatch(t *testing.T) {
+	dir := t.TempDir()
+
+	rsaKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	publicDER, err := x509.MarshalPKIXPublicKey(&rsaKey.PublicKey)
+	require.NoError(t, err)
+	writePEM(t, dir, "rsa-public", "PUBLIC KEY", publicDER)
+
+	useKeyConfig(t, "shared-secret", dir, "")
+	assert.Len(t, JWKS().Keys, 1)
+
+	// An HS256 token keyed with the public key must not pass as RS256.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, testClaims())
+	forged.Header["kid"] = "rsa-public"
+	tokenString, err := forged.SignedString(publicDER)
+	require.NoError(t, err)
+
+	_, err = ParseToken(tokenString)
+	assert.Error(t, err)
+}
@@ -0,0 +1,42 @@
+package utils
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"strings"
+)
+
+func GenerateSecureToken(byteLength int) (string, error) {
+	b := make([]byte, byteLength)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %v", err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// APIKeyPrefix marks API keys so they can be told apart from JWTs and
+// spotted by secret scanners.
+const APIKeyPrefix = "fms_"
+
+// GenerateAPIKey returns a new key and the short prefix shown to users to
+// identify it after creation.
+func GenerateAPIKey() (key, displayPrefix string, err error) {
+	secret, err := GenerateSecureToken(32)
+	if err != nil {
+		return "", "", err
+	}
+	key = APIKeyPrefix + secret
+	return key, key[:len(APIKeyPrefix)+8], nil
+}
+
+func IsAPIKey(credential string) bool {
+	return strings.HasPrefix(credential, APIKeyPrefix)
+}
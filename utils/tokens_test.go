@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGenerateSecureToken(t *testing.T) {
+	first, err := GenerateSecureToken(32)
+	assert.NoError(t, err)
+	assert.Len(t, first, 43)
+
+	second, err := GenerateSecureToken(32)
+	assert.NoError(t, err)
+	assert.NotEqual(t, first, second)
+
+	assert.Equal(t, HashToken(first), HashToken(first))
+	assert.NotEqual(t, HashToken(first), HashToken(second))
+}
@@ -0,0 +1,51 @@
+package utils
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// RFC 6238 appendix B test vectors truncated to six digits.
+func TestValidateTOTP(t *testing.T) {
+	secret := totpEncoding.EncodeToString([]byte("12345678901234567890"))
+
+	cases := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+	for unix, code := range cases {
+		step, ok := ValidateTOTP(secret, code, time.Unix(unix, 0))
+		assert.True(t, ok, "code at %d", unix)
+		assert.Equal(t, unix/totpPeriod, step)
+	}
+
+	_, ok := ValidateTOTP(secret, "287082", time.Unix(59+3*totpPeriod, 0))
+	assert.False(t, ok)
+	_, ok = ValidateTOTP(secret, "28708", time.Unix(59, 0))
+	assert.False(t, ok)
+}
+
+func TestGenerateTOTPSecretAndURI(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	assert.NoError(t, err)
+	assert.Len(t, secret, 32)
+
+	uri := TOTPURI("File Manager", "test@example.com", secret)
+	assert.True(t, strings.HasPrefix(uri, "otpauth://totp/File%20Manager:test@example.com?"))
+	assert.Contains(t, uri, "secret="+secret)
+}
+
+func TestRecoveryCodes(t *testing.T) {
+	codes, err := GenerateRecoveryCodes(10)
+	assert.NoError(t, err)
+	assert.Len(t, codes, 10)
+	assert.Len(t, codes[0], 11)
+	assert.NotEqual(t, codes[0], codes[1])
+
+	assert.Equal(t, codes[0], NormalizeRecoveryCode(" "+strings.ToUpper(strings.ReplaceAll(codes[0], "-", ""))+" "))
+}